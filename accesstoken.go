@@ -0,0 +1,183 @@
+package dpop
+
+import (
+	"crypto"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const DEFAULT_ACCESS_TOKEN_LIFETIME = time.Hour
+
+// The `typ` header of JWT access tokens. See https://datatracker.ietf.org/doc/html/rfc9068#section-2.1
+const AccessTokenType = "at+jwt"
+
+// AccessTokenClaims are the claims of a JWT access token bound to the key of a proof.
+// See https://datatracker.ietf.org/doc/html/rfc9068#section-2.2
+//
+// They embed BoundAccessTokenClaims and implement the BoundClaims interface,
+// so they can be used when parsing access tokens at a protected resource.
+type AccessTokenClaims struct {
+	*BoundAccessTokenClaims
+
+	// The client the token was issued to.
+	ClientID string `json:"client_id"`
+
+	// The scopes of the token separated by spaces.
+	Scope string `json:"scope,omitempty"`
+}
+
+// AccessTokenIssuerOptions and its contents are optional for the NewAccessTokenIssuer function.
+type AccessTokenIssuerOptions struct {
+	// The `kid` header of issued tokens, used by protected resources to find the verification key in a JWK set.
+	// If not set the SHA-256 JWK thumbprint of the public key is used.
+	KeyID string
+
+	// The method used to sign tokens. If not set it is chosen from the type of the key.
+	SigningMethod jwt.SigningMethod
+
+	// The lifetime of issued tokens. If not set the default is 1 hour.
+	Lifetime *time.Duration
+
+	// Used to get the current time. If not set time.Now is used.
+	Now func() time.Time
+}
+
+// AccessTokenRequest holds the grant specific values of an access token.
+type AccessTokenRequest struct {
+	// The `sub` claim, the resource owner or the client itself for grants without a resource owner.
+	Subject string
+
+	// The `client_id` claim.
+	ClientID string
+
+	// The `aud` claim, the protected resources the token is intended for.
+	Audience []string
+
+	// The scopes of the token, encoded as the space separated `scope` claim.
+	Scope []string
+
+	// Overrides the lifetime of the issuer for this token.
+	Lifetime *time.Duration
+}
+
+// AccessTokenIssuer creates JWT access tokens according to https://datatracker.ietf.org/doc/html/rfc9068
+// that are bound to the key of a proof with the `cnf.jkt` claim. See https://datatracker.ietf.org/doc/html/rfc9449#section-6.1
+type AccessTokenIssuer struct {
+	issuer   string
+	key      crypto.Signer
+	jwk      JWK
+	method   jwt.SigningMethod
+	lifetime time.Duration
+	now      func() time.Time
+}
+
+// NewAccessTokenIssuer creates an AccessTokenIssuer that signs tokens with the supplied key
+// and sets the `iss` claim to the supplied issuer identifier.
+func NewAccessTokenIssuer(issuer string, key crypto.Signer, opts AccessTokenIssuerOptions) (*AccessTokenIssuer, error) {
+	jwk, err := FromPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	jwk.Kid = opts.KeyID
+	if jwk.Kid == "" {
+		jwk.Kid, err = jwk.Thumbprint(crypto.SHA256)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	method := opts.SigningMethod
+	if method == nil {
+		method, err = signingMethodForKey(key.Public())
+		if err != nil {
+			return nil, err
+		}
+	}
+	lifetime := DEFAULT_ACCESS_TOKEN_LIFETIME
+	if opts.Lifetime != nil {
+		lifetime = *opts.Lifetime
+	}
+	now := time.Now
+	if opts.Now != nil {
+		now = opts.Now
+	}
+
+	return &AccessTokenIssuer{
+		issuer:   issuer,
+		key:      key,
+		jwk:      *jwk,
+		method:   method,
+		lifetime: lifetime,
+		now:      now,
+	}, nil
+}
+
+// Issue creates a signed access token bound to the key of the proof.
+//
+// The proof should have been parsed from the token request. The claims of the token are returned
+// so that the token response can be created from them.
+func (i *AccessTokenIssuer) Issue(proof *Proof, req AccessTokenRequest) (string, *AccessTokenClaims, error) {
+	if proof == nil || proof.PublicKey() == "" {
+		return "", nil, ErrMissingJWK
+	}
+	if req.Subject == "" || req.ClientID == "" || len(req.Audience) == 0 {
+		return "", nil, ErrMissingAccessTokenClaims
+	}
+
+	jti, err := randomID()
+	if err != nil {
+		return "", nil, err
+	}
+	lifetime := i.lifetime
+	if req.Lifetime != nil {
+		lifetime = *req.Lifetime
+	}
+	now := i.now()
+
+	claims := &AccessTokenClaims{
+		BoundAccessTokenClaims: &BoundAccessTokenClaims{
+			RegisteredClaims: &jwt.RegisteredClaims{
+				Issuer:    i.issuer,
+				Subject:   req.Subject,
+				Audience:  req.Audience,
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(lifetime)),
+				ID:        jti,
+			},
+			Confirmation: Confirmation{JWKThumbprint: proof.PublicKey()},
+		},
+		ClientID: req.ClientID,
+		Scope:    strings.Join(req.Scope, " "),
+	}
+
+	token := jwt.NewWithClaims(i.method, claims)
+	token.Header["typ"] = AccessTokenType
+	token.Header["kid"] = i.jwk.Kid
+	signed, err := token.SignedString(i.key)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
+}
+
+// JWKSet is a set of public keys. See https://datatracker.ietf.org/doc/html/rfc7517#section-5
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKSet returns the public key of the issuer with its `kid`, to be served to protected resources.
+func (i *AccessTokenIssuer) JWKSet() JWKSet {
+	return JWKSet{Keys: []JWK{i.jwk}}
+}
+
+// Key returns the key with the supplied `kid`.
+func (s JWKSet) Key(kid string) (*JWK, bool) {
+	for i := range s.Keys {
+		if s.Keys[i].Kid == kid {
+			return &s.Keys[i], true
+		}
+	}
+	return nil, false
+}
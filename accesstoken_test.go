@@ -0,0 +1,195 @@
+package dpop_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AxisCommunications/go-dpop"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Parses an access token with the keys of a JWK set, looked up by the `kid` header.
+func parseTestAccessToken(t *testing.T, accessToken string, jwks dpop.JWKSet) *jwt.Token {
+	t.Helper()
+	token, err := jwt.ParseWithClaims(accessToken, &dpop.AccessTokenClaims{}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		jwk, ok := jwks.Key(kid)
+		if !ok {
+			return nil, errors.New("unknown kid")
+		}
+		return jwk.PublicKey()
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return token
+}
+
+// Test that an issued access token follows RFC 9068 and is bound to the key of the proof
+func TestAccessTokenIssuer_Issue(t *testing.T) {
+	// Arrange
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := mustParseURL(t, "https://server.example.com/token")
+	proof, err := dpop.Parse(createTestProof(t, clientKey, dpop.POST, u.String(), "", ""), dpop.POST, u, dpop.ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Truncate(time.Second)
+	underTest, err := dpop.NewAccessTokenIssuer("https://server.example.com", serverKey, dpop.AccessTokenIssuerOptions{
+		Now: func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	accessToken, claims, err := underTest.Issue(proof, dpop.AccessTokenRequest{
+		Subject:  "user",
+		ClientID: "client",
+		Audience: []string{"https://resource.example.com"},
+		Scope:    []string{"read", "write"},
+	})
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := parseTestAccessToken(t, accessToken, underTest.JWKSet())
+	parsedClaims := token.Claims.(*dpop.AccessTokenClaims)
+	jwk, err := dpop.FromPublicKey(serverKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, err := jwk.Thumbprint(crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Header["typ"] != "at+jwt" || token.Header["kid"] != kid || token.Method != jwt.SigningMethodES384 {
+		t.Errorf("Unexpected header %v", token.Header)
+	}
+	if parsedClaims.Issuer != "https://server.example.com" || parsedClaims.Subject != "user" || parsedClaims.ClientID != "client" ||
+		parsedClaims.Scope != "read write" || parsedClaims.Audience[0] != "https://resource.example.com" || parsedClaims.ID == "" {
+		t.Errorf("Unexpected claims %+v", parsedClaims)
+	}
+	if !parsedClaims.ExpiresAt.Equal(now.Add(dpop.DEFAULT_ACCESS_TOKEN_LIFETIME)) || !parsedClaims.IssuedAt.Equal(now) {
+		t.Errorf("Unexpected lifetime %v to %v", parsedClaims.IssuedAt, parsedClaims.ExpiresAt)
+	}
+	if claims.Confirmation.JWKThumbprint != proof.PublicKey() || parsedClaims.Confirmation.JWKThumbprint != proof.PublicKey() {
+		t.Errorf("Expected token to be bound to the key of the proof")
+	}
+
+	resourceURL := mustParseURL(t, "https://resource.example.com/")
+	resourceProof, err := dpop.Parse(createTestProof(t, clientKey, dpop.GET, resourceURL.String(), accessToken, ""), dpop.GET, resourceURL, dpop.ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resourceProof.ValidateAccessToken(accessToken, parsedClaims); err != nil {
+		t.Errorf("Expected proof to be valid for the access token, got %v", err)
+	}
+}
+
+// Test that the key ID and lifetime can be configured
+func TestAccessTokenIssuer_Options(t *testing.T) {
+	// Arrange
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := mustParseURL(t, "https://server.example.com/token")
+	proof, err := dpop.Parse(createTestProof(t, clientKey, dpop.POST, u.String(), "", ""), dpop.POST, u, dpop.ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Truncate(time.Second)
+	issuerLifetime := 10 * time.Minute
+	requestLifetime := 2 * time.Minute
+	underTest, err := dpop.NewAccessTokenIssuer("https://server.example.com", serverKey, dpop.AccessTokenIssuerOptions{
+		KeyID:    "auth-key",
+		Lifetime: &issuerLifetime,
+		Now:      func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := dpop.AccessTokenRequest{Subject: "user", ClientID: "client", Audience: []string{"resource"}}
+
+	// Act
+	_, claims, err := underTest.Issue(proof, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Lifetime = &requestLifetime
+	accessToken, overridden, err := underTest.Issue(proof, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Assert
+	token := parseTestAccessToken(t, accessToken, underTest.JWKSet())
+	if token.Header["kid"] != "auth-key" {
+		t.Errorf("Unexpected kid %v", token.Header["kid"])
+	}
+	if !claims.ExpiresAt.Equal(now.Add(issuerLifetime)) {
+		t.Errorf("Unexpected expiry %v", claims.ExpiresAt)
+	}
+	if !overridden.ExpiresAt.Equal(now.Add(requestLifetime)) {
+		t.Errorf("Unexpected overridden expiry %v", overridden.ExpiresAt)
+	}
+	if claims.Scope != "" {
+		t.Errorf("Expected no scope, got %q", claims.Scope)
+	}
+}
+
+// Test that tokens are not issued without the required claims or a proof
+func TestAccessTokenIssuer_MissingClaims(t *testing.T) {
+	// Arrange
+	serverKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	underTest, err := dpop.NewAccessTokenIssuer("https://server.example.com", serverKey, dpop.AccessTokenIssuerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof := &dpop.Proof{HashedPublicKey: "jkt"}
+
+	testCases := []struct {
+		name     string
+		proof    *dpop.Proof
+		req      dpop.AccessTokenRequest
+		expected error
+	}{
+		{name: "missing proof", proof: nil, req: dpop.AccessTokenRequest{Subject: "user", ClientID: "client", Audience: []string{"resource"}}, expected: dpop.ErrMissingJWK},
+		{name: "missing subject", proof: proof, req: dpop.AccessTokenRequest{ClientID: "client", Audience: []string{"resource"}}, expected: dpop.ErrMissingAccessTokenClaims},
+		{name: "missing client", proof: proof, req: dpop.AccessTokenRequest{Subject: "user", Audience: []string{"resource"}}, expected: dpop.ErrMissingAccessTokenClaims},
+		{name: "missing audience", proof: proof, req: dpop.AccessTokenRequest{Subject: "user", ClientID: "client"}, expected: dpop.ErrMissingAccessTokenClaims},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			// Act
+			_, _, err := underTest.Issue(testCase.proof, testCase.req)
+
+			// Assert
+			if !errors.Is(err, testCase.expected) {
+				t.Errorf("Expected error %v, got %v", testCase.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package dpop
+
+import (
+	"container/heap"
+	"context"
+	"crypto"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// The authorization request parameter used to bind an authorization code to a key.
+// See https://datatracker.ietf.org/doc/html/rfc9449#section-10
+const JKTParameter = "dpop_jkt"
+
+// JKT returns the `dpop_jkt` value of a public key, which is its base64url encoded SHA-256 JWK thumbprint.
+//
+// A client can use this to bind an authorization code to the key it will later sign proofs with,
+// before it has sent any proof.
+func JKT(publicKey crypto.PublicKey) (string, error) {
+	jwk, err := FromPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	return jwk.Thumbprint(crypto.SHA256)
+}
+
+// SetJKT adds the `dpop_jkt` parameter to the parameters of an authorization request or a pushed authorization request.
+// See https://datatracker.ietf.org/doc/html/rfc9449#section-10 and https://datatracker.ietf.org/doc/html/rfc9126
+func SetJKT(params url.Values, jkt string) {
+	params.Set(JKTParameter, jkt)
+}
+
+// AuthorizationURLWithJKT returns the authorization URL with the `dpop_jkt` query parameter added.
+func AuthorizationURLWithJKT(authURL string, jkt string) (string, error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	SetJKT(query, jkt)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// JKTFromRequest reads the `dpop_jkt` parameter of an authorization request or a pushed authorization request.
+//
+// An empty string is returned if the request does not have the parameter.
+// If a pushed authorization request also has a proof, the authorization server must check that
+// the proof is signed with the same key by parsing it with the returned value as ParseOptions.JKT.
+// See https://datatracker.ietf.org/doc/html/rfc9449#section-10.1
+func JKTFromRequest(r *http.Request) (string, error) {
+	if err := r.ParseForm(); err != nil {
+		return "", errors.Join(ErrInvalidRequest, err)
+	}
+	values, ok := r.Form[JKTParameter]
+	if !ok {
+		return "", nil
+	}
+	if len(values) != 1 {
+		return "", errors.Join(ErrInvalidRequest, ErrInvalidJKT)
+	}
+
+	// The thumbprint is a base64url encoded SHA-256 hash.
+	jkt := values[0]
+	if hash, err := base64.RawURLEncoding.DecodeString(jkt); err != nil || len(hash) != crypto.SHA256.Size() {
+		return "", errors.Join(ErrInvalidRequest, ErrInvalidJKT)
+	}
+	return jkt, nil
+}
+
+// How long a MemoryCodeBindingStore or MemoryRefreshTokenBindingStore keeps bindings after they have expired,
+// so that an expired binding is reported with ErrExpiredBinding instead of as a code or token that was never bound.
+const EXPIRED_BINDING_RETENTION = 24 * time.Hour
+
+// CodeBindingStore remembers the `dpop_jkt` that authorization codes were issued for, or that they were issued without one,
+// so that the token endpoint can require the code to be redeemed with a proof signed by the same key.
+// Codes issued without `dpop_jkt` are recorded too, so that a code whose binding has been removed is not taken for an unbound code.
+//
+// At redemption the stored value is used as ParseOptions.JKT when parsing the proof of the token request,
+// which rejects proofs signed with another key with an ErrIncorrectJKT error.
+type CodeBindingStore interface {
+	// SaveCodeBinding stores the `dpop_jkt` of an authorization code until it expires.
+	// An empty `dpop_jkt` records a code that was issued without one.
+	SaveCodeBinding(ctx context.Context, code string, jkt string, expiry time.Time) error
+
+	// LoadCodeBinding returns the `dpop_jkt` of an authorization code without removing it.
+	// An empty string is returned if the code was issued without `dpop_jkt`.
+	// If no binding is stored ErrMissingBinding is returned and if the binding has expired ErrExpiredBinding is returned,
+	// so that the code is rejected instead of treated as unbound.
+	LoadCodeBinding(ctx context.Context, code string) (string, error)
+
+	// DeleteCodeBinding removes the binding of an authorization code once the code has been redeemed.
+	// Bindings must not be removed before, so that a proof signed with another key can not leave the code unbound.
+	DeleteCodeBinding(ctx context.Context, code string) error
+}
+
+// MemoryCodeBindingStore is a CodeBindingStore that keeps bindings in memory.
+// It is safe for concurrent use.
+type MemoryCodeBindingStore struct {
+	mu       sync.Mutex
+	bindings *expiringBindings
+}
+
+// NewMemoryCodeBindingStore creates an empty MemoryCodeBindingStore.
+func NewMemoryCodeBindingStore() *MemoryCodeBindingStore {
+	return &MemoryCodeBindingStore{
+		bindings: newExpiringBindings(),
+	}
+}
+
+// Implement the CodeBindingStore interface.
+//
+// Bindings that expired more than EXPIRED_BINDING_RETENTION ago are removed whenever a new binding is saved.
+func (s *MemoryCodeBindingStore) SaveCodeBinding(ctx context.Context, code string, jkt string, expiry time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.bindings.save(code, jkt, expiry, time.Now())
+	return nil
+}
+
+// Implement the CodeBindingStore interface.
+//
+// ErrMissingBinding is returned for codes whose binding has been deleted or removed after it expired.
+func (s *MemoryCodeBindingStore) LoadCodeBinding(ctx context.Context, code string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.bindings.load(code, time.Now())
+}
+
+// Implement the CodeBindingStore interface.
+func (s *MemoryCodeBindingStore) DeleteCodeBinding(ctx context.Context, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.bindings.delete(code)
+	return nil
+}
+
+// The bindings of a memory store, ordered by expiry in a heap
+// so that expired bindings are removed without scanning every binding.
+// It is not safe for concurrent use.
+type expiringBindings struct {
+	bindings map[string]*expiringBinding
+	byExpiry bindingHeap
+}
+
+type expiringBinding struct {
+	key    string
+	jkt    string
+	expiry time.Time
+	index  int
+}
+
+func newExpiringBindings() *expiringBindings {
+	return &expiringBindings{bindings: map[string]*expiringBinding{}}
+}
+
+// Stores a binding after removing the bindings that expired more than EXPIRED_BINDING_RETENTION ago.
+// Bindings with a zero expiry do not expire.
+func (b *expiringBindings) save(key string, jkt string, expiry time.Time, now time.Time) {
+	for len(b.byExpiry) > 0 && !b.byExpiry[0].expiry.IsZero() && !now.Before(b.byExpiry[0].expiry.Add(EXPIRED_BINDING_RETENTION)) {
+		delete(b.bindings, heap.Pop(&b.byExpiry).(*expiringBinding).key)
+	}
+
+	if binding, ok := b.bindings[key]; ok {
+		binding.jkt = jkt
+		binding.expiry = expiry
+		heap.Fix(&b.byExpiry, binding.index)
+		return
+	}
+	binding := &expiringBinding{key: key, jkt: jkt, expiry: expiry}
+	heap.Push(&b.byExpiry, binding)
+	b.bindings[key] = binding
+}
+
+// Returns the `jkt` of a binding, ErrMissingBinding if there is no binding or ErrExpiredBinding if it has expired.
+func (b *expiringBindings) load(key string, now time.Time) (string, error) {
+	binding, ok := b.bindings[key]
+	if !ok {
+		return "", ErrMissingBinding
+	}
+	if !binding.expiry.IsZero() && !now.Before(binding.expiry) {
+		return "", ErrExpiredBinding
+	}
+	return binding.jkt, nil
+}
+
+func (b *expiringBindings) delete(key string) {
+	binding, ok := b.bindings[key]
+	if !ok {
+		return
+	}
+	heap.Remove(&b.byExpiry, binding.index)
+	delete(b.bindings, key)
+}
+
+// Implements heap.Interface with the binding that expires first at the top and bindings that do not expire last.
+type bindingHeap []*expiringBinding
+
+func (h bindingHeap) Len() int { return len(h) }
+
+func (h bindingHeap) Less(i, j int) bool {
+	if h[i].expiry.IsZero() || h[j].expiry.IsZero() {
+		return h[j].expiry.IsZero() && !h[i].expiry.IsZero()
+	}
+	return h[i].expiry.Before(h[j].expiry)
+}
+
+func (h bindingHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *bindingHeap) Push(x interface{}) {
+	binding := x.(*expiringBinding)
+	binding.index = len(*h)
+	*h = append(*h, binding)
+}
+
+func (h *bindingHeap) Pop() interface{} {
+	old := *h
+	binding := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return binding
+}
@@ -0,0 +1,232 @@
+package dpop_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AxisCommunications/go-dpop"
+)
+
+// Test that the `dpop_jkt` of a key matches the public key of proofs signed with it
+func TestJKT_MatchesProof(t *testing.T) {
+	// Arrange
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := mustParseURL(t, "https://server.example.com/token")
+	proof, err := dpop.Parse(createTestProof(t, key, dpop.POST, u.String(), "", ""), dpop.POST, u, dpop.ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	jkt, err := dpop.JKT(key.Public())
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jkt != proof.PublicKey() {
+		t.Errorf("Expected jkt %s to match proof public key %s", jkt, proof.PublicKey())
+	}
+}
+
+// Test that the `dpop_jkt` parameter is added to an authorization URL without dropping other parameters
+func TestAuthorizationURLWithJKT(t *testing.T) {
+	// Act
+	authURL, err := dpop.AuthorizationURLWithJKT("https://server.example.com/authorize?client_id=client&state=xyz", "jkt")
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := mustParseURL(t, authURL).Query()
+	if query.Get("dpop_jkt") != "jkt" || query.Get("client_id") != "client" || query.Get("state") != "xyz" {
+		t.Errorf("Unexpected authorization URL %s", authURL)
+	}
+}
+
+// Test that the `dpop_jkt` parameter is read from authorization and pushed authorization requests
+func TestJKTFromRequest(t *testing.T) {
+	// Arrange
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jkt, err := dpop.JKT(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	form := url.Values{}
+	dpop.SetJKT(form, jkt)
+
+	testCases := []struct {
+		name        string
+		method      string
+		target      string
+		body        string
+		expected    string
+		expectedErr error
+	}{
+		{name: "query", method: "GET", target: "/authorize?dpop_jkt=" + jkt, expected: jkt},
+		{name: "form", method: "POST", target: "/par", body: form.Encode(), expected: jkt},
+		{name: "missing", method: "GET", target: "/authorize", expected: ""},
+		{name: "not a thumbprint", method: "GET", target: "/authorize?dpop_jkt=abc", expectedErr: dpop.ErrInvalidJKT},
+		{name: "repeated", method: "GET", target: "/authorize?dpop_jkt=" + jkt + "&dpop_jkt=" + jkt, expectedErr: dpop.ErrInvalidJKT},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(testCase.method, "https://server.example.com"+testCase.target, strings.NewReader(testCase.body))
+			if testCase.body != "" {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+
+			// Act
+			result, err := dpop.JKTFromRequest(req)
+
+			// Assert
+			if testCase.expectedErr != nil {
+				if !errors.Is(err, testCase.expectedErr) || !errors.Is(err, dpop.ErrInvalidRequest) {
+					t.Errorf("Expected error %v, got %v", testCase.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != testCase.expected {
+				t.Errorf("Expected %q, got %q", testCase.expected, result)
+			}
+		})
+	}
+}
+
+// Test that a bound authorization code can only be redeemed with a proof signed by the bound key
+func TestMemoryCodeBindingStore_Redemption(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jkt, err := dpop.JKT(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	underTest := dpop.NewMemoryCodeBindingStore()
+	if err := underTest.SaveCodeBinding(ctx, "code", jkt, time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	u := mustParseURL(t, "https://server.example.com/token")
+
+	// Act
+	boundJKT, err := underTest.LoadCodeBinding(ctx, "code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errOtherKey := dpop.Parse(createTestProof(t, otherKey, dpop.POST, u.String(), "", ""), dpop.POST, u, dpop.ParseOptions{JKT: boundJKT})
+	_, errBoundKey := dpop.Parse(createTestProof(t, key, dpop.POST, u.String(), "", ""), dpop.POST, u, dpop.ParseOptions{JKT: boundJKT})
+	if err := underTest.DeleteCodeBinding(ctx, "code"); err != nil {
+		t.Fatal(err)
+	}
+	afterDelete, afterDeleteErr := underTest.LoadCodeBinding(ctx, "code")
+
+	// Assert
+	if boundJKT != jkt {
+		t.Errorf("Expected bound jkt %s, got %s", jkt, boundJKT)
+	}
+	AssertJoinedError(t, errOtherKey, dpop.ErrIncorrectJKT)
+	if errBoundKey != nil {
+		t.Errorf("Expected proof signed with bound key to be accepted, got %v", errBoundKey)
+	}
+	if afterDelete != "" || !errors.Is(afterDeleteErr, dpop.ErrMissingBinding) {
+		t.Errorf("Expected binding to be removed after it was deleted, got %q: %v", afterDelete, afterDeleteErr)
+	}
+}
+
+// Test that an expired binding is reported as expired and not as an unbound code
+func TestMemoryCodeBindingStore_Expired(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	underTest := dpop.NewMemoryCodeBindingStore()
+	if err := underTest.SaveCodeBinding(ctx, "code", "jkt", time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	jkt, err := underTest.LoadCodeBinding(ctx, "code")
+	_, secondErr := underTest.LoadCodeBinding(ctx, "code")
+
+	// Assert
+	if jkt != "" {
+		t.Errorf("Expected expired binding to not be returned")
+	}
+	if !errors.Is(err, dpop.ErrExpiredBinding) || !errors.Is(secondErr, dpop.ErrExpiredBinding) {
+		t.Errorf("Expected error %v, got %v and %v", dpop.ErrExpiredBinding, err, secondErr)
+	}
+}
+
+// Test that bindings that expired longer than the retention ago are removed when a binding is saved
+func TestMemoryCodeBindingStore_Eviction(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	now := time.Now()
+	retained := now.Add(-dpop.EXPIRED_BINDING_RETENTION / 2)
+	evicted := now.Add(-2 * dpop.EXPIRED_BINDING_RETENTION)
+	underTest := dpop.NewMemoryCodeBindingStore()
+	bindings := []struct {
+		code   string
+		expiry time.Time
+	}{
+		{code: "evicted", expiry: evicted},
+		{code: "retained", expiry: retained},
+		{code: "renewed", expiry: evicted},
+		{code: "deleted", expiry: evicted},
+		{code: "valid", expiry: now.Add(time.Minute)},
+		{code: "renewed", expiry: now.Add(time.Hour)},
+	}
+	for _, binding := range bindings {
+		if err := underTest.SaveCodeBinding(ctx, binding.code, "jkt", binding.expiry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := underTest.DeleteCodeBinding(ctx, "deleted"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	if err := underTest.SaveCodeBinding(ctx, "new", "jkt", now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Assert
+	expected := map[string]error{
+		"evicted":  dpop.ErrMissingBinding,
+		"retained": dpop.ErrExpiredBinding,
+		"deleted":  dpop.ErrMissingBinding,
+	}
+	for code, expectedErr := range expected {
+		if jkt, err := underTest.LoadCodeBinding(ctx, code); jkt != "" || !errors.Is(err, expectedErr) {
+			t.Errorf("Expected %q to load with error %v, got %q and %v", code, expectedErr, jkt, err)
+		}
+	}
+	for _, code := range []string{"valid", "renewed", "new"} {
+		if jkt, err := underTest.LoadCodeBinding(ctx, code); jkt != "jkt" || err != nil {
+			t.Errorf("Expected %q to be bound, got %q and %v", code, jkt, err)
+		}
+	}
+}
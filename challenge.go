@@ -0,0 +1,152 @@
+package dpop
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Error codes used in responses to rejected requests.
+// See https://datatracker.ietf.org/doc/html/rfc9449#section-12.2, https://datatracker.ietf.org/doc/html/rfc6750#section-3.1
+// and https://datatracker.ietf.org/doc/html/rfc6749#section-5.2
+const (
+	ErrorCodeInvalidDPoPProof = "invalid_dpop_proof"
+	ErrorCodeUseDPoPNonce     = "use_dpop_nonce"
+	ErrorCodeInvalidToken     = "invalid_token"
+	ErrorCodeInvalidRequest   = "invalid_request"
+	ErrorCodeServerError      = "server_error"
+)
+
+var errorDescriptions = map[string]string{
+	ErrorCodeInvalidDPoPProof: "The DPoP proof is invalid",
+	ErrorCodeUseDPoPNonce:     "A nonce from the server is required in the DPoP proof",
+	ErrorCodeInvalidToken:     "The access token is invalid",
+	ErrorCodeInvalidRequest:   "The request is malformed",
+	ErrorCodeServerError:      "The server failed to process the request",
+}
+
+// ErrorResponseOptions and its contents are optional for the NewErrorResponse function.
+type ErrorResponseOptions struct {
+	// The algorithms advertised in the `algs` parameter of the challenge. If not set DefaultAllowedAlgorithms is used.
+	AllowedAlgorithms []string
+
+	// A new nonce that is sent in the `DPoP-Nonce` header.
+	Nonce string
+
+	// If set the response is created for a token endpoint, with a JSON error body instead of a challenge.
+	// See https://datatracker.ietf.org/doc/html/rfc6749#section-5.2
+	TokenEndpoint bool
+}
+
+// ErrorResponse is a response to a request that was rejected because of an error returned by Parse or Proof.Validate.
+type ErrorResponse struct {
+	// The HTTP status code of the response.
+	Status int
+
+	// The error code of the response, empty if the request did not contain any credentials.
+	ErrorCode string
+
+	// The headers of the response.
+	Header http.Header
+
+	// The body of the response, only set for token endpoints.
+	Body []byte
+}
+
+// ErrorCode returns the error code that a server should respond with for an error returned by Parse or Proof.Validate.
+//
+// An empty string is returned if the request did not contain any DPoP access token.
+// Errors that are not caused by the request, such as ErrIntrospectionFailed or errors of a key store,
+// are mapped to ErrorCodeServerError.
+func ErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrMissingAccessToken):
+		return ""
+	case errors.Is(err, ErrIntrospectionFailed):
+		return ErrorCodeServerError
+	case errors.Is(err, ErrIncorrectNonce):
+		return ErrorCodeUseDPoPNonce
+	case errors.Is(err, ErrInvalidRequest):
+		return ErrorCodeInvalidRequest
+	case errors.Is(err, ErrInvalidToken), errors.Is(err, ErrIncorrectAccessTokenClaimsType):
+		return ErrorCodeInvalidToken
+	case errors.Is(err, ErrInvalidProof):
+		return ErrorCodeInvalidDPoPProof
+	default:
+		return ErrorCodeServerError
+	}
+}
+
+// NewErrorResponse creates the response for an error returned by Parse or Proof.Validate.
+//
+// Protected resources respond with a `WWW-Authenticate: DPoP` challenge according to https://datatracker.ietf.org/doc/html/rfc9449#section-7.1
+// while token endpoints respond with a JSON error body according to https://datatracker.ietf.org/doc/html/rfc9449#section-5
+// If a nonce is supplied it is sent in the `DPoP-Nonce` header according to https://datatracker.ietf.org/doc/html/rfc9449#section-8
+// Server errors are responded to with status 500 and without a challenge.
+func NewErrorResponse(err error, opts ErrorResponseOptions) *ErrorResponse {
+	code := ErrorCode(err)
+	res := &ErrorResponse{
+		ErrorCode: code,
+		Header:    http.Header{},
+	}
+	if opts.Nonce != "" {
+		res.Header.Set("DPoP-Nonce", opts.Nonce)
+	}
+
+	if opts.TokenEndpoint {
+		if code == "" {
+			code = ErrorCodeInvalidRequest
+			res.ErrorCode = code
+		}
+		res.Status = http.StatusBadRequest
+		if code == ErrorCodeServerError {
+			res.Status = http.StatusInternalServerError
+		}
+		res.Header.Set("Content-Type", "application/json")
+		res.Header.Set("Cache-Control", "no-store")
+		// Marshalling a map of strings can not fail.
+		res.Body, _ = json.Marshal(map[string]string{
+			"error":             code,
+			"error_description": errorDescriptions[code],
+		})
+		return res
+	}
+
+	if code == ErrorCodeServerError {
+		res.Status = http.StatusInternalServerError
+		return res
+	}
+	res.Status = http.StatusUnauthorized
+	if code == ErrorCodeInvalidRequest {
+		res.Status = http.StatusBadRequest
+	}
+
+	algs := opts.AllowedAlgorithms
+	if algs == nil {
+		algs = DefaultAllowedAlgorithms()
+	}
+	challenge := fmt.Sprintf("DPoP algs=\"%s\"", strings.Join(algs, " "))
+	if code != "" {
+		challenge = fmt.Sprintf("DPoP error=\"%s\", error_description=\"%s\", algs=\"%s\"", code, errorDescriptions[code], strings.Join(algs, " "))
+	}
+	res.Header.Set("WWW-Authenticate", challenge)
+	return res
+}
+
+// Write writes the response.
+func (r *ErrorResponse) Write(w http.ResponseWriter) {
+	for key, values := range r.Header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(r.Status)
+	if r.Body != nil {
+		_, _ = w.Write(r.Body)
+	}
+}
+
+// WriteError writes the response for an error returned by Parse or Proof.Validate. See NewErrorResponse.
+func WriteError(w http.ResponseWriter, err error, opts ErrorResponseOptions) {
+	NewErrorResponse(err, opts).Write(w)
+}
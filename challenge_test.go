@@ -0,0 +1,121 @@
+package dpop_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AxisCommunications/go-dpop"
+)
+
+// Test that errors are mapped to the correct error codes
+func TestErrorCode(t *testing.T) {
+	testCases := map[string]struct {
+		err      error
+		expected string
+	}{
+		"invalid proof":      {err: errors.Join(dpop.ErrInvalidProof, dpop.ErrExpired), expected: dpop.ErrorCodeInvalidDPoPProof},
+		"missing jwk":        {err: errors.Join(dpop.ErrInvalidProof, dpop.ErrMissingJWK), expected: dpop.ErrorCodeInvalidDPoPProof},
+		"incorrect nonce":    {err: errors.Join(dpop.ErrIncorrectNonce, dpop.ErrNonceExpired), expected: dpop.ErrorCodeUseDPoPNonce},
+		"invalid token":      {err: dpop.ErrIncorrectAccessTokenClaimsType, expected: dpop.ErrorCodeInvalidToken},
+		"malformed request":  {err: dpop.ErrInvalidRequest, expected: dpop.ErrorCodeInvalidRequest},
+		"missing credential": {err: dpop.ErrMissingAccessToken, expected: ""},
+		"introspection":      {err: errors.Join(dpop.ErrInvalidToken, dpop.ErrIntrospectionFailed), expected: dpop.ErrorCodeServerError},
+		"key store":          {err: errors.New("key store unavailable"), expected: dpop.ErrorCodeServerError},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			actual := dpop.ErrorCode(testCase.err)
+
+			// Assert
+			if actual != testCase.expected {
+				t.Errorf("Expected %q, got %q", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+// Test that a protected resource responds with a challenge
+func TestWriteError_ResourceServer(t *testing.T) {
+	// Arrange
+	w := httptest.NewRecorder()
+
+	// Act
+	dpop.WriteError(w, errors.Join(dpop.ErrIncorrectNonce), dpop.ErrorResponseOptions{
+		AllowedAlgorithms: []string{"ES256", "EdDSA"},
+		Nonce:             "nonce",
+	})
+
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	expectedChallenge := `DPoP error="use_dpop_nonce", error_description="A nonce from the server is required in the DPoP proof", algs="ES256 EdDSA"`
+	if challenge := w.Header().Get("WWW-Authenticate"); challenge != expectedChallenge {
+		t.Errorf("Expected challenge %q, got %q", expectedChallenge, challenge)
+	}
+	if nonce := w.Header().Get("DPoP-Nonce"); nonce != "nonce" {
+		t.Errorf("Expected nonce header, got %q", nonce)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("Expected empty body")
+	}
+}
+
+// Test that a token endpoint responds with a JSON error body
+func TestWriteError_TokenEndpoint(t *testing.T) {
+	// Arrange
+	w := httptest.NewRecorder()
+
+	// Act
+	dpop.WriteError(w, errors.Join(dpop.ErrInvalidProof, dpop.ErrExpired), dpop.ErrorResponseOptions{TokenEndpoint: true})
+
+	// Assert
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if challenge := w.Header().Get("WWW-Authenticate"); challenge != "" {
+		t.Errorf("Expected no challenge, got %q", challenge)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected JSON content type, got %q", contentType)
+	}
+	body := map[string]string{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if body["error"] != dpop.ErrorCodeInvalidDPoPProof {
+		t.Errorf("Expected error %q, got %q", dpop.ErrorCodeInvalidDPoPProof, body["error"])
+	}
+}
+
+// Test that errors not caused by the request are responded to as server errors
+func TestWriteError_ServerError(t *testing.T) {
+	// Arrange
+	resourceServer := httptest.NewRecorder()
+	tokenEndpoint := httptest.NewRecorder()
+	err := errors.New("key store unavailable")
+
+	// Act
+	dpop.WriteError(resourceServer, err, dpop.ErrorResponseOptions{})
+	dpop.WriteError(tokenEndpoint, err, dpop.ErrorResponseOptions{TokenEndpoint: true})
+
+	// Assert
+	if resourceServer.Code != http.StatusInternalServerError || tokenEndpoint.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d and %d", http.StatusInternalServerError, resourceServer.Code, tokenEndpoint.Code)
+	}
+	if challenge := resourceServer.Header().Get("WWW-Authenticate"); challenge != "" {
+		t.Errorf("Expected no challenge, got %q", challenge)
+	}
+	body := map[string]string{}
+	if err := json.Unmarshal(tokenEndpoint.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if body["error"] != dpop.ErrorCodeServerError {
+		t.Errorf("Expected error %q, got %q", dpop.ErrorCodeServerError, body["error"])
+	}
+}
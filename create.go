@@ -4,9 +4,9 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/rsa"
 	"encoding/base64"
-	"math/big"
 
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -14,11 +14,18 @@ import (
 // Creates a DPoP proof for the given claims.
 //
 // For custom claims it is recommended to embedd the 'ProofTokenClaims'.
+// If method is nil the signing method is chosen from the type of the key.
 func Create(method jwt.SigningMethod, claims ProofClaims, privateKey crypto.Signer) (string, error) {
-	jwk, err := reflect(privateKey.Public())
+	jwk, err := FromPublicKey(privateKey.Public())
 	if err != nil {
 		return "", err
 	}
+	if method == nil {
+		method, err = signingMethodForKey(privateKey.Public())
+		if err != nil {
+			return "", err
+		}
+	}
 
 	token := &jwt.Token{
 		Header: map[string]interface{}{
@@ -33,49 +40,32 @@ func Create(method jwt.SigningMethod, claims ProofClaims, privateKey crypto.Sign
 	return token.SignedString(privateKey)
 }
 
-type ecdsaJWK struct {
-	X   string `json:"x"`
-	Y   string `json:"y"`
-	Crv string `json:"crv"`
-	Kty string `json:"kty"`
-}
-
-type rsaJWK struct {
-	Exponent string `json:"e"`
-	Modulus  string `json:"n"`
-	Kty      string `json:"kty"`
-}
-
-type ed25519JWK struct {
-	PublicKey string `json:"x"`
-	Kty       string `json:"kty"`
-}
-
-func reflect(v interface{}) (interface{}, error) {
-	switch v := v.(type) {
+// Returns the signing method to use for proofs signed with a key of the supplied type.
+func signingMethodForKey(publicKey crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch key := publicKey.(type) {
 	case *ecdsa.PublicKey:
-		// Calculate the size of the byte array representation of an elliptic curve coordinate
-		// and ensure that the byte array representation of the key is padded correctly.
-		bits := v.Curve.Params().BitSize
-		keyCurveBytesSize := bits/8 + bits%8
-
-		return &ecdsaJWK{
-			X:   base64.RawURLEncoding.EncodeToString(v.X.FillBytes(make([]byte, keyCurveBytesSize))),
-			Y:   base64.RawURLEncoding.EncodeToString(v.Y.FillBytes(make([]byte, keyCurveBytesSize))),
-			Crv: v.Curve.Params().Name,
-			Kty: "EC",
-		}, nil
+		switch key.Curve.Params().Name {
+		case "P-256":
+			return jwt.SigningMethodES256, nil
+		case "P-384":
+			return jwt.SigningMethodES384, nil
+		case "P-521":
+			return jwt.SigningMethodES512, nil
+		}
+		return nil, ErrUnsupportedCurve
 	case *rsa.PublicKey:
-		return &rsaJWK{
-			Exponent: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(v.E)).Bytes()),
-			Modulus:  base64.RawURLEncoding.EncodeToString(v.N.Bytes()),
-			Kty:      "RSA",
-		}, nil
+		return jwt.SigningMethodRS256, nil
 	case ed25519.PublicKey:
-		return &ed25519JWK{
-			PublicKey: base64.RawURLEncoding.EncodeToString(v),
-			Kty:       "OKP",
-		}, nil
+		return jwt.SigningMethodEdDSA, nil
 	}
 	return nil, ErrUnsupportedKeyAlgorithm
 }
+
+// Returns a random identifier suitable as the `jti` of a proof.
+func randomID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
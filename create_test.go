@@ -310,3 +310,32 @@ func (testKey) Public() crypto.PublicKey {
 func (testKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) (signature []byte, err error) {
 	return []byte(""), nil
 }
+
+// Test that the signing method is chosen from the type of the key if none is supplied
+func TestCreate_DefaultSigningMethod(t *testing.T) {
+	claims := &dpop.ProofTokenClaims{
+		RegisteredClaims: &jwt.RegisteredClaims{
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+			ID:       "id",
+		},
+		Method: dpop.POST,
+		URL:    "https://server.example.com/token",
+	}
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := dpop.Create(nil, claims, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := jwt.NewParser().ParseUnverified(res, &dpop.ProofTokenClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Header["alg"] != jwt.SigningMethodES384.Alg() {
+		t.Errorf("expected alg %s, got %v", jwt.SigningMethodES384.Alg(), token.Header["alg"])
+	}
+}
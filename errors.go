@@ -13,6 +13,42 @@ var (
 	// When this error is returned the the server needs to supply the client with a new nonce.
 	ErrIncorrectNonce = errors.New("use_dpop_nonce")
 
+	// The request does not have a `DPoP` access token in the `Authorization` header.
+	ErrMissingAccessToken = errors.New("missing access token")
+
+	// The access token could not be verified.
+	ErrInvalidToken = errors.New("invalid_token")
+
+	// The access token is not active according to its introspection response.
+	ErrInactiveToken = errors.New("access token is not active")
+
+	// The access token is not a DPoP bound access token according to its introspection response.
+	ErrIncorrectTokenType = errors.New("incorrect token type")
+
+	// The introspection endpoint could not be reached or returned an invalid response.
+	ErrIntrospectionFailed = errors.New("introspection failed")
+
+	// The request is malformed.
+	ErrInvalidRequest = errors.New("invalid_request")
+
+	// The request does not have a `DPoP` header.
+	ErrMissingProof = errors.New("missing 'dpop' header")
+
+	// The request has more than one `DPoP` header.
+	ErrMultipleProofs = errors.New("multiple 'dpop' headers")
+
+	// The nonce was not issued by the server or has been tampered with.
+	ErrInvalidNonce = errors.New("invalid nonce")
+
+	// The nonce was issued too long ago.
+	ErrNonceExpired = errors.New("nonce has expired")
+
+	// There is no key to issue nonces with.
+	ErrMissingNonceKey = errors.New("missing nonce key")
+
+	// A key used to issue nonces is too short.
+	ErrNonceKeyTooShort = errors.New("nonce key is too short")
+
 	// The claims of the DPoP proof are invalid.
 	ErrMissingClaims = errors.New("missing claims")
 
@@ -22,6 +58,9 @@ var (
 	// The `htm` and `htu` headers of the proof target the wrong resource.
 	ErrIncorrectHTTPTarget = errors.New("incorrect http target")
 
+	// The `htu` claim of the proof is not an absolute URL.
+	ErrInvalidHTU = errors.New("invalid 'htu' claim")
+
 	// The proof has expired.
 	ErrExpired = errors.New("proof has expired")
 
@@ -43,15 +82,51 @@ var (
 	// The proof 'jwk' public header does not match supplied jkt
 	ErrIncorrectJKT = errors.New("incorrect 'jkt'")
 
+	// The `dpop_jkt` parameter of an authorization request is not a SHA-256 JWK thumbprint
+	ErrInvalidJKT = errors.New("invalid 'dpop_jkt' parameter")
+
+	// The key binding of an authorization code or refresh token has expired
+	ErrExpiredBinding = errors.New("key binding has expired")
+
+	// A refresh token that must be bound to a key has no key binding
+	ErrMissingBinding = errors.New("missing key binding")
+
 	// The bound token 'jkt' claim does not match public key in proof
 	ErrJWKMismatch = errors.New("key mismatch")
 
+	// The `sub`, `client_id` or `aud` claim of an access token to issue is missing
+	ErrMissingAccessTokenClaims = errors.New("missing access token claims")
+
 	// The bound access token claims are not of correct type
 	ErrIncorrectAccessTokenClaimsType = errors.New("incorrect access token claims type")
 
 	// The proof public key has an unsupported curve
 	ErrUnsupportedCurve = errors.New("unsupported curve")
 
+	// The proof public key is not a valid point on its curve
+	ErrInvalidCurvePoint = errors.New("public key is not on curve")
+
+	// The proof RSA public key has a modulus smaller than the allowed minimum size
+	ErrRSAKeyTooSmall = errors.New("rsa key is too small")
+
+	// The proof RSA public key has an invalid exponent
+	ErrInvalidRSAExponent = errors.New("invalid rsa exponent")
+
+	// The JWK is missing required members or has members that can not be decoded
+	ErrInvalidJWK = errors.New("invalid jwk")
+
+	// The hash function used for a JWK thumbprint is not available
+	ErrUnsupportedHash = errors.New("unsupported hash function")
+
 	// The proof uses an unsupported key algorithm
 	ErrUnsupportedKeyAlgorithm = errors.New("unsupported key algorithm")
+
+	// The proof `alg` header is not one of the allowed signing algorithms
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+
+	// The proof `alg` header can not be used with the key type or curve of the `jwk` header
+	ErrAlgorithmMismatch = errors.New("signing algorithm does not match key")
+
+	// The proof `jti` has already been used
+	ErrReplayed = errors.New("proof has already been used")
 )
@@ -1,27 +1,19 @@
 package main
 
 import (
-	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
-	"crypto/sha256"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"time"
+	"net/url"
+	"strings"
 
 	"github.com/AxisCommunications/go-dpop"
-	"github.com/golang-jwt/jwt/v5"
 )
 
-type tokenRequestBody struct {
-	Resource string   `json:"resource"`
-	Scope    []string `json:"scope"`
-}
-
 func main() {
 	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
@@ -29,37 +21,27 @@ func main() {
 	}
 
 	// Create a DPoP proof token in order to request a bound token from the authorization server
-	claims := dpop.ProofTokenClaims{
-		RegisteredClaims: &jwt.RegisteredClaims{
-			Issuer:    "client",
-			Subject:   "user",
-			Audience:  jwt.ClaimStrings{"https://server.example.com/token"},
-			ID:        "random_id",
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-		Method: dpop.POST,
-		URL:    "https://server.example.com/token",
+	tokenProof, err := dpop.NewProof(dpop.POST, "http://localhost:1337/token", dpop.ProofOptions{})
+	if err != nil {
+		panic(err)
 	}
-	proof, err := dpop.Create(jwt.SigningMethodES256, &claims, privateKey)
+	proof, err := tokenProof.Sign(privateKey)
 	if err != nil {
 		panic(err)
 	}
 
 	// Request a bound token from the authorization server
 	fmt.Println("Client - requesting a bound token from the authorization server")
-	body := tokenRequestBody{
-		Resource: "https://server.example.com/resource",
-		Scope:    []string{"read", "write"},
-	}
-	jsonBody, err := json.Marshal(body)
-	if err != nil {
-		panic(err)
+	body := url.Values{
+		"grant_type": {"client_credentials"},
+		"resource":   {"http://localhost:40000/resource"},
+		"scope":      {"read write"},
 	}
-	req, err := http.NewRequest("POST", "http://localhost:1337/token", bytes.NewReader(jsonBody))
+	req, err := http.NewRequest("POST", "http://localhost:1337/token", strings.NewReader(body.Encode()))
 	if err != nil {
 		panic(err)
 	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Add("dpop", proof)
 	res, err := http.DefaultClient.Do(req)
 	if err != nil {
@@ -67,43 +49,32 @@ func main() {
 	}
 
 	// Read the bound token from the response
-	boundTokenString, err := io.ReadAll(res.Body)
+	tokenResponse := dpop.TokenResponse{}
+	err = json.NewDecoder(res.Body).Decode(&tokenResponse)
 	if err != nil {
 		panic(err)
 	}
 	res.Body.Close()
-	fmt.Printf("Client - received bound token: %s\n", boundTokenString)
+	boundTokenString := tokenResponse.AccessToken
+	fmt.Printf("Client - received bound token of type %s: %s\n", tokenResponse.TokenType, boundTokenString)
 
 	// Create a bound DPoP proof token in order to access the resource server
-	h := sha256.New()
-	_, err = h.Write([]byte(boundTokenString))
+	resourceProof, err := dpop.NewProof(dpop.GET, "http://localhost:40000/resource", dpop.ProofOptions{
+		// This binds the proof to the bound token
+		AccessToken: boundTokenString,
+	})
 	if err != nil {
 		panic(err)
 	}
-	ath := base64.RawURLEncoding.EncodeToString(h.Sum(nil))
-	claims = dpop.ProofTokenClaims{
-		RegisteredClaims: &jwt.RegisteredClaims{
-			Issuer:    "client",
-			Subject:   "user",
-			Audience:  jwt.ClaimStrings{"https://server.example.com/resource"},
-			ID:        "random_id",
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-		Method: dpop.GET,
-		URL:    "https://server.example.com/resource",
-		// This binds the proof to the bound token
-		AccessTokenHash: ath,
-	}
 	// Sign with the same private key used to sign the proof that was sent to the authorization server
-	boundProof, err := dpop.Create(jwt.SigningMethodES256, &claims, privateKey)
+	boundProof, err := resourceProof.Sign(privateKey)
 	if err != nil {
 		panic(err)
 	}
 
 	// Access the resource server
 	fmt.Println("Client - accessing the resource server")
-	req, err = http.NewRequest("POST", "http://localhost:40000/resource", bytes.NewReader(jsonBody))
+	req, err = http.NewRequest("GET", "http://localhost:40000/resource", nil)
 	if err != nil {
 		panic(err)
 	}
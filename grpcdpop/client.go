@@ -0,0 +1,188 @@
+package grpcdpop
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/AxisCommunications/go-dpop"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// The call has no request info to derive the `htu` of its proof from.
+var ErrMissingRequestInfo = errors.New("missing request info of call")
+
+// CredentialsOptions and its contents are optional for the NewCredentials function.
+type CredentialsOptions struct {
+	// The method used to sign proofs. If not set it is chosen from the type of the key.
+	SigningMethod jwt.SigningMethod
+
+	// The authority used in the `htu` of proofs. If not set the authority of the connection is used.
+	Authority string
+
+	// If set the credentials can be sent on connections without transport security, for example in tests.
+	Insecure bool
+}
+
+// Credentials is a credentials.PerRPCCredentials that sends a DPoP bound access token with a new proof for every call.
+//
+// Nonces received in the `dpop-nonce` trailer are included in the proofs of later calls. They are only received
+// if the interceptors returned by UnaryClientInterceptor and StreamClientInterceptor are installed on the connection.
+// Since a single nonce is remembered, the same Credentials should not be used with several servers.
+// See https://datatracker.ietf.org/doc/html/rfc9449#section-8
+type Credentials struct {
+	key    crypto.Signer
+	tokens oauth2.TokenSource
+	opts   CredentialsOptions
+
+	mu    sync.Mutex
+	nonce string
+}
+
+// NewCredentials creates Credentials that sign proofs with the supplied key
+// and send the access tokens of the token source, which must be bound to the key.
+func NewCredentials(key crypto.Signer, tokens oauth2.TokenSource, opts CredentialsOptions) *Credentials {
+	return &Credentials{
+		key:    key,
+		tokens: tokens,
+		opts:   opts,
+	}
+}
+
+// Implement the credentials.PerRPCCredentials interface.
+//
+// The proof has the `htm` POST, the `htu` of the method and the `ath` of the access token.
+func (c *Credentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	requestInfo, ok := credentials.RequestInfoFromContext(ctx)
+	if !ok {
+		return nil, ErrMissingRequestInfo
+	}
+	authority := c.opts.Authority
+	if authority == "" {
+		if len(uri) == 0 {
+			return nil, ErrMissingRequestInfo
+		}
+		u, err := url.Parse(uri[0])
+		if err != nil {
+			return nil, err
+		}
+		authority = u.Host
+	}
+
+	token, err := c.tokens.Token()
+	if err != nil {
+		return nil, err
+	}
+	proof, err := c.createProof(MethodURL(authority, requestInfo.Method), token.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{
+		AuthorizationMetadataKey: "DPoP " + token.AccessToken,
+		ProofMetadataKey:         proof,
+	}, nil
+}
+
+// Implement the credentials.PerRPCCredentials interface.
+func (c *Credentials) RequireTransportSecurity() bool {
+	return !c.opts.Insecure
+}
+
+// UnaryClientInterceptor returns an interceptor that remembers nonces received in the `dpop-nonce` trailer.
+//
+// If a call is rejected with a `use_dpop_nonce` error it is retried once with the new nonce.
+func (c *Credentials) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		var trailer metadata.MD
+		err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Trailer(&trailer))...)
+		if !c.updateNonce(trailer) || !isNonceError(err, trailer) {
+			return err
+		}
+
+		// Retry the call once with the new nonce, keeping any nonce sent when the retry is rejected too.
+		var retryTrailer metadata.MD
+		err = invoker(ctx, method, req, reply, cc, append(opts, grpc.Trailer(&retryTrailer))...)
+		c.updateNonce(retryTrailer)
+		return err
+	}
+}
+
+// StreamClientInterceptor returns an interceptor that remembers nonces received in the `dpop-nonce` trailer of streams.
+// Streams are not retried, the new nonce is used when the next stream is opened.
+func (c *Credentials) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &clientStream{ClientStream: stream, credentials: c}, nil
+	}
+}
+
+// A client stream that reads the nonce of the trailer once the stream has ended.
+type clientStream struct {
+	grpc.ClientStream
+	credentials *Credentials
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		s.credentials.updateNonce(s.ClientStream.Trailer())
+	}
+	return err
+}
+
+// Remembers the nonce of a trailer and returns true if a new nonce was received.
+func (c *Credentials) updateNonce(trailer metadata.MD) bool {
+	nonces := trailer.Get(NonceMetadataKey)
+	if len(nonces) == 0 || nonces[0] == "" {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nonce = nonces[0]
+	return true
+}
+
+// Checks if a call was rejected because of a missing or incorrect nonce. See https://datatracker.ietf.org/doc/html/rfc9449#section-9
+func isNonceError(err error, trailer metadata.MD) bool {
+	if status.Code(err) != codes.Unauthenticated {
+		return false
+	}
+	for _, challenge := range trailer.Get(ChallengeMetadataKey) {
+		if strings.Contains(challenge, `error="`+dpop.ErrorCodeUseDPoPNonce+`"`) {
+			return true
+		}
+	}
+	return false
+}
+
+// Creates a proof for a call to the URL, bound to the access token.
+func (c *Credentials) createProof(u *url.URL, accessToken string) (string, error) {
+	c.mu.Lock()
+	nonce := c.nonce
+	c.mu.Unlock()
+
+	builder, err := dpop.NewProof(Method, u.String(), dpop.ProofOptions{
+		Nonce:         nonce,
+		AccessToken:   accessToken,
+		SigningMethod: c.opts.SigningMethod,
+	})
+	if err != nil {
+		return "", err
+	}
+	return builder.Sign(c.key)
+}
@@ -0,0 +1,175 @@
+package grpcdpop_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/AxisCommunications/go-dpop"
+	"github.com/AxisCommunications/go-dpop/grpcdpop"
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Helper function to create credentials sending an access token bound to the client key.
+func newTestCredentials(t *testing.T, keys testKeys) *grpcdpop.Credentials {
+	t.Helper()
+	tokens := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: keys.accessToken(t), TokenType: dpop.TokenTypeDPoP})
+	return grpcdpop.NewCredentials(keys.client, tokens, grpcdpop.CredentialsOptions{Insecure: true})
+}
+
+// Test that unary and streaming calls with the credentials are accepted by the server interceptors
+func TestCredentials(t *testing.T) {
+	// Arrange
+	keys := newTestKeys(t)
+	underTest := newTestCredentials(t, keys)
+	client := grpc_health_v1.NewHealthClient(newTestConn(t,
+		grpcdpop.ServerOptions{ParseAccessToken: keys.parseAccessToken},
+		grpc.WithPerRPCCredentials(underTest),
+	))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Act
+	_, unaryErr := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	stream, err := client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, streamErr := stream.Recv()
+
+	// Assert
+	if unaryErr != nil {
+		t.Errorf("Unexpected error: %v", unaryErr)
+	}
+	if streamErr != nil {
+		t.Errorf("Unexpected error: %v", streamErr)
+	}
+}
+
+// Test that a unary call rejected with a `use_dpop_nonce` error is retried with the new nonce
+func TestCredentials_UnaryNonce(t *testing.T) {
+	// Arrange
+	keys := newTestKeys(t)
+	nonceIssuer, err := dpop.NewNonceIssuer([][]byte{bytes.Repeat([]byte("a"), dpop.MINIMUM_NONCE_KEY_SIZE)}, dpop.NonceOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	underTest := newTestCredentials(t, keys)
+	client := grpc_health_v1.NewHealthClient(newTestConn(t,
+		grpcdpop.ServerOptions{ParseAccessToken: keys.parseAccessToken, NonceIssuer: nonceIssuer},
+		grpc.WithPerRPCCredentials(underTest),
+		grpc.WithUnaryInterceptor(underTest.UnaryClientInterceptor()),
+	))
+
+	// Act
+	_, firstErr := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	_, secondErr := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+
+	// Assert
+	if firstErr != nil || secondErr != nil {
+		t.Errorf("Unexpected errors: %v, %v", firstErr, secondErr)
+	}
+}
+
+// Test that a nonce received when a stream is rejected is used for the next stream
+func TestCredentials_StreamNonce(t *testing.T) {
+	// Arrange
+	keys := newTestKeys(t)
+	nonceIssuer, err := dpop.NewNonceIssuer([][]byte{bytes.Repeat([]byte("a"), dpop.MINIMUM_NONCE_KEY_SIZE)}, dpop.NonceOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	underTest := newTestCredentials(t, keys)
+	client := grpc_health_v1.NewHealthClient(newTestConn(t,
+		grpcdpop.ServerOptions{ParseAccessToken: keys.parseAccessToken, NonceIssuer: nonceIssuer},
+		grpc.WithPerRPCCredentials(underTest),
+		grpc.WithStreamInterceptor(underTest.StreamClientInterceptor()),
+	))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Act
+	rejected, err := client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, rejectedErr := rejected.Recv()
+	accepted, err := client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, acceptedErr := accepted.Recv()
+
+	// Assert
+	if status.Code(rejectedErr) != codes.Unauthenticated {
+		t.Errorf("Expected code %v, got %v", codes.Unauthenticated, rejectedErr)
+	}
+	if acceptedErr != nil {
+		t.Errorf("Unexpected error: %v", acceptedErr)
+	}
+}
+
+// Test that the credentials require transport security unless configured otherwise
+func TestCredentials_RequireTransportSecurity(t *testing.T) {
+	// Arrange
+	keys := newTestKeys(t)
+	tokens := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})
+
+	// Act
+	secure := grpcdpop.NewCredentials(keys.client, tokens, grpcdpop.CredentialsOptions{})
+	insecure := grpcdpop.NewCredentials(keys.client, tokens, grpcdpop.CredentialsOptions{Insecure: true})
+
+	// Assert
+	if !secure.RequireTransportSecurity() || insecure.RequireTransportSecurity() {
+		t.Errorf("Unexpected transport security requirements")
+	}
+}
+
+// Test that a nonce received when the retry of a unary call is rejected is used for the next call
+func TestCredentials_UnaryNonceOfRetry(t *testing.T) {
+	// Arrange
+	keys := newTestKeys(t)
+	nonceIssuer, err := dpop.NewNonceIssuer([][]byte{bytes.Repeat([]byte("a"), dpop.MINIMUM_NONCE_KEY_SIZE)}, dpop.NonceOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, err := nonceIssuer.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	underTest := newTestCredentials(t, keys)
+	nonces := []string{"stale-nonce", nonce}
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		for _, opt := range opts {
+			if trailer, ok := opt.(grpc.TrailerCallOption); ok {
+				*trailer.TrailerAddr = metadata.Pairs(
+					grpcdpop.NonceMetadataKey, nonces[0],
+					grpcdpop.ChallengeMetadataKey, `DPoP error="use_dpop_nonce"`,
+				)
+			}
+		}
+		nonces = nonces[1:]
+		return status.Error(codes.Unauthenticated, dpop.ErrorCodeUseDPoPNonce)
+	}
+	client := grpc_health_v1.NewHealthClient(newTestConn(t,
+		grpcdpop.ServerOptions{ParseAccessToken: keys.parseAccessToken, NonceIssuer: nonceIssuer},
+		grpc.WithPerRPCCredentials(underTest),
+	))
+
+	// Act
+	rejectedErr := underTest.UnaryClientInterceptor()(context.Background(), testCheckMethod, nil, nil, nil, invoker)
+	_, err = client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+
+	// Assert
+	if status.Code(rejectedErr) != codes.Unauthenticated || len(nonces) != 0 {
+		t.Errorf("Expected the call to be retried once, got %v", rejectedErr)
+	}
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
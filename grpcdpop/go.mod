@@ -0,0 +1,20 @@
+module github.com/AxisCommunications/go-dpop/grpcdpop
+
+go 1.20
+
+require (
+	github.com/AxisCommunications/go-dpop v0.0.0-00010101000000-000000000000
+	github.com/golang-jwt/jwt/v5 v5.2.1
+	golang.org/x/oauth2 v0.26.0
+	google.golang.org/grpc v1.63.2
+)
+
+require (
+	golang.org/x/net v0.21.0 // indirect
+	golang.org/x/sys v0.17.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240227224415-6ceb2ff114de // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
+)
+
+replace github.com/AxisCommunications/go-dpop => ../
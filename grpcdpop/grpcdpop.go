@@ -0,0 +1,40 @@
+// Package grpcdpop adds DPoP support to gRPC services and clients.
+//
+// Proofs and access tokens travel in request metadata. Since gRPC has no HTTP method or URL of its own,
+// the `htm` claim of a proof is always POST and the `htu` claim is the URI of the method,
+// https://<authority>/<package>.<Service>/<Method>. See https://datatracker.ietf.org/doc/html/rfc9449
+package grpcdpop
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/AxisCommunications/go-dpop"
+)
+
+// Metadata keys used to carry DPoP proofs, access tokens and nonces.
+const (
+	// The proof of a call.
+	ProofMetadataKey = "dpop"
+
+	// The `DPoP` access token of a call.
+	AuthorizationMetadataKey = "authorization"
+
+	// A new nonce sent by the server in the trailer of a rejected call. See https://datatracker.ietf.org/doc/html/rfc9449#section-8
+	NonceMetadataKey = "dpop-nonce"
+
+	// The challenge sent by the server in the trailer of a rejected call. See https://datatracker.ietf.org/doc/html/rfc9449#section-7.1
+	ChallengeMetadataKey = "www-authenticate"
+)
+
+// The `htm` claim of proofs for gRPC calls.
+const Method = dpop.POST
+
+// MethodURL returns the `htu` of a call to the full method name, such as "/package.Service/Method", on the authority.
+func MethodURL(authority string, fullMethod string) *url.URL {
+	return &url.URL{
+		Scheme: "https",
+		Host:   authority,
+		Path:   "/" + strings.TrimPrefix(fullMethod, "/"),
+	}
+}
@@ -0,0 +1,186 @@
+package grpcdpop
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/AxisCommunications/go-dpop"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ServerOptions configures the server interceptors.
+type ServerOptions struct {
+	// Options used when parsing the proof of a call.
+	ParseOptions dpop.ParseOptions
+
+	// Verifies the access token of a call and returns its claims. It is required.
+	// Claims of the *dpop.IntrospectionResponse type are validated with dpop.Proof.ValidateIntrospection, other claims with dpop.Proof.ValidateAccessToken.
+	// Any error returned causes the call to be rejected with an `invalid_token` error, except dpop.ErrIntrospectionFailed which is a `server_error`.
+	ParseAccessToken func(ctx context.Context, accessToken string) (dpop.BoundClaims, error)
+
+	// Used to issue and verify server nonces. If set it is used as ParseOptions.NonceVerifier
+	// and a new nonce is sent in the `dpop-nonce` trailer when a call is rejected because of its nonce.
+	NonceIssuer *dpop.NonceIssuer
+
+	// The authority used in the `htu` of proofs. If not set the `:authority` of the call is used.
+	Authority string
+}
+
+// UnaryServerInterceptor protects unary methods with DPoP bound access tokens.
+//
+// It reads the `DPoP` access token from the `authorization` metadata and the proof from the `dpop` metadata,
+// parses the proof with dpop.Parse and validates that it is bound to the access token.
+// Rejected calls fail with codes.Unauthenticated, or codes.InvalidArgument for malformed calls,
+// and the challenge and any new nonce are sent in the trailer. Calls that fail because of a server error fail with codes.Internal.
+//
+// The verified proof and access token are available to the handler through dpop.ProofFromContext and dpop.AccessTokenFromContext.
+// UnaryServerInterceptor panics if opts.ParseAccessToken is not set.
+func UnaryServerInterceptor(opts ServerOptions) grpc.UnaryServerInterceptor {
+	opts = checkOptions(opts)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authorize(ctx, info.FullMethod, opts)
+		if err != nil {
+			trailer, statusErr := rejection(err, opts)
+			_ = grpc.SetTrailer(ctx, trailer)
+			return nil, statusErr
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor protects streaming methods with DPoP bound access tokens.
+// The proof is verified once when the stream is opened. See UnaryServerInterceptor.
+func StreamServerInterceptor(opts ServerOptions) grpc.StreamServerInterceptor {
+	opts = checkOptions(opts)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authorize(ss.Context(), info.FullMethod, opts)
+		if err != nil {
+			trailer, statusErr := rejection(err, opts)
+			ss.SetTrailer(trailer)
+			return statusErr
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// A server stream with the context of the verified call.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// Panics on missing options and uses the nonce issuer as nonce verifier.
+func checkOptions(opts ServerOptions) ServerOptions {
+	if opts.ParseAccessToken == nil {
+		panic("grpcdpop: ServerOptions.ParseAccessToken is required")
+	}
+	if opts.NonceIssuer != nil {
+		opts.ParseOptions.NonceVerifier = opts.NonceIssuer
+	}
+	return opts
+}
+
+// Verifies the proof and access token of a call and returns a context carrying them.
+func authorize(ctx context.Context, fullMethod string, opts ServerOptions) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	accessToken, err := accessTokenFromMetadata(md)
+	if err != nil {
+		return ctx, err
+	}
+
+	proofStrings := md.Get(ProofMetadataKey)
+	if len(proofStrings) == 0 {
+		return ctx, errors.Join(dpop.ErrInvalidProof, dpop.ErrMissingProof)
+	}
+	if len(proofStrings) > 1 {
+		return ctx, errors.Join(dpop.ErrInvalidProof, dpop.ErrMultipleProofs)
+	}
+	authority := opts.Authority
+	if authority == "" {
+		authorities := md.Get(":authority")
+		if len(authorities) != 1 {
+			return ctx, dpop.ErrInvalidRequest
+		}
+		authority = authorities[0]
+	}
+	proof, err := dpop.Parse(proofStrings[0], Method, MethodURL(authority, fullMethod), opts.ParseOptions)
+	if err != nil {
+		return ctx, err
+	}
+
+	boundClaims, err := opts.ParseAccessToken(ctx, accessToken)
+	if err != nil {
+		return ctx, errors.Join(dpop.ErrInvalidToken, err)
+	}
+	if boundClaims == nil {
+		return ctx, dpop.ErrInvalidToken
+	}
+	if introspection, ok := boundClaims.(*dpop.IntrospectionResponse); ok {
+		err = proof.ValidateIntrospection(accessToken, introspection)
+	} else {
+		err = proof.ValidateAccessToken(accessToken, boundClaims)
+	}
+	if err != nil {
+		return ctx, err
+	}
+
+	return dpop.NewContext(ctx, proof, accessToken), nil
+}
+
+// Reads a `DPoP` access token from the `authorization` metadata.
+func accessTokenFromMetadata(md metadata.MD) (string, error) {
+	authorizations := md.Get(AuthorizationMetadataKey)
+	if len(authorizations) == 0 {
+		return "", dpop.ErrMissingAccessToken
+	}
+	if len(authorizations) > 1 {
+		return "", dpop.ErrInvalidRequest
+	}
+
+	scheme, accessToken, ok := strings.Cut(authorizations[0], " ")
+	if !ok || !strings.EqualFold(scheme, "DPoP") {
+		return "", dpop.ErrMissingAccessToken
+	}
+	accessToken = strings.TrimSpace(accessToken)
+	if accessToken == "" {
+		return "", dpop.ErrInvalidRequest
+	}
+	return accessToken, nil
+}
+
+// Creates the trailer and status of a rejected call from the HTTP error response of the error.
+func rejection(err error, opts ServerOptions) (metadata.MD, error) {
+	responseOptions := dpop.ErrorResponseOptions{AllowedAlgorithms: opts.ParseOptions.AllowedAlgorithms}
+	if opts.NonceIssuer != nil && dpop.ErrorCode(err) == dpop.ErrorCodeUseDPoPNonce {
+		if nonce, err := opts.NonceIssuer.Issue(); err == nil {
+			responseOptions.Nonce = nonce
+		}
+	}
+	res := dpop.NewErrorResponse(err, responseOptions)
+
+	trailer := metadata.MD{}
+	for key, values := range res.Header {
+		trailer.Append(key, values...)
+	}
+	code := codes.Unauthenticated
+	switch res.Status {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusInternalServerError:
+		code = codes.Internal
+	}
+	message := res.ErrorCode
+	if message == "" {
+		message = "missing DPoP access token"
+	}
+	return trailer, status.Error(code, message)
+}
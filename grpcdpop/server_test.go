@@ -0,0 +1,463 @@
+package grpcdpop_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AxisCommunications/go-dpop"
+	"github.com/AxisCommunications/go-dpop/grpcdpop"
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	testAuthority   = "device.example.com"
+	testCheckMethod = "/grpc.health.v1.Health/Check"
+	testWatchMethod = "/grpc.health.v1.Health/Watch"
+)
+
+// Keys of the authorization server and the client.
+type testKeys struct {
+	server *ecdsa.PrivateKey
+	client *ecdsa.PrivateKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+	server, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKeys{server: server, client: client}
+}
+
+// Helper function to create an access token bound to the client key.
+func (k testKeys) accessToken(t *testing.T) string {
+	t.Helper()
+	jkt, err := dpop.JKT(k.client.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, &dpop.BoundAccessTokenClaims{
+		RegisteredClaims: &jwt.RegisteredClaims{
+			Subject:   "client",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Confirmation: dpop.Confirmation{JWKThumbprint: jkt},
+	}).SignedString(k.server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// Helper function to verify access tokens signed by the server key.
+func (k testKeys) parseAccessToken(ctx context.Context, accessToken string) (dpop.BoundClaims, error) {
+	claims := &dpop.BoundAccessTokenClaims{}
+	_, err := jwt.ParseWithClaims(accessToken, claims, func(*jwt.Token) (interface{}, error) {
+		return k.server.Public(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodES256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// Helper function to create a proof for a call signed by the supplied key.
+func createTestProof(t *testing.T, key *ecdsa.PrivateKey, fullMethod string, accessToken string, nonce string) string {
+	t.Helper()
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		t.Fatal(err)
+	}
+	proof, err := dpop.Create(jwt.SigningMethodES256, &dpop.ProofTokenClaims{
+		RegisteredClaims: &jwt.RegisteredClaims{
+			ID:       base64.RawURLEncoding.EncodeToString(id),
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+		Method:          grpcdpop.Method,
+		URL:             grpcdpop.MethodURL(testAuthority, fullMethod).String(),
+		AccessTokenHash: dpop.AccessTokenHash(accessToken),
+		Nonce:           nonce,
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proof
+}
+
+// Starts a health service protected by the interceptors and returns a connection to it.
+func newTestConn(t *testing.T, opts grpcdpop.ServerOptions, dialOptions ...grpc.DialOption) *grpc.ClientConn {
+	t.Helper()
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(grpcdpop.UnaryServerInterceptor(opts)),
+		grpc.StreamInterceptor(grpcdpop.StreamServerInterceptor(opts)),
+	)
+	grpc_health_v1.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	dialOptions = append(dialOptions,
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	conn, err := grpc.NewClient("passthrough:///"+testAuthority, dialOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+// Test that unary calls are accepted with a valid proof and rejected with the status and challenge of the error
+func TestUnaryServerInterceptor(t *testing.T) {
+	keys := newTestKeys(t)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessToken := keys.accessToken(t)
+	conn := newTestConn(t, grpcdpop.ServerOptions{ParseAccessToken: keys.parseAccessToken})
+
+	testCases := []struct {
+		name              string
+		metadata          []string
+		expectedCode      codes.Code
+		expectedChallenge string
+	}{
+		{
+			name:         "valid",
+			metadata:     []string{"authorization", "DPoP " + accessToken, "dpop", createTestProof(t, keys.client, testCheckMethod, accessToken, "")},
+			expectedCode: codes.OK,
+		},
+		{
+			name:              "missing access token",
+			metadata:          []string{"dpop", createTestProof(t, keys.client, testCheckMethod, accessToken, "")},
+			expectedCode:      codes.Unauthenticated,
+			expectedChallenge: "DPoP algs=",
+		},
+		{
+			name:              "missing proof",
+			metadata:          []string{"authorization", "DPoP " + accessToken},
+			expectedCode:      codes.Unauthenticated,
+			expectedChallenge: `DPoP error="invalid_dpop_proof"`,
+		},
+		{
+			name:              "proof for another method",
+			metadata:          []string{"authorization", "DPoP " + accessToken, "dpop", createTestProof(t, keys.client, testWatchMethod, accessToken, "")},
+			expectedCode:      codes.Unauthenticated,
+			expectedChallenge: `DPoP error="invalid_dpop_proof"`,
+		},
+		{
+			name:              "proof signed by another key",
+			metadata:          []string{"authorization", "DPoP " + accessToken, "dpop", createTestProof(t, otherKey, testCheckMethod, accessToken, "")},
+			expectedCode:      codes.Unauthenticated,
+			expectedChallenge: `DPoP error="invalid_dpop_proof"`,
+		},
+		{
+			name:              "invalid access token",
+			metadata:          []string{"authorization", "DPoP invalid", "dpop", createTestProof(t, keys.client, testCheckMethod, "invalid", "")},
+			expectedCode:      codes.Unauthenticated,
+			expectedChallenge: `DPoP error="invalid_token"`,
+		},
+		{
+			name:              "multiple access tokens",
+			metadata:          []string{"authorization", "DPoP " + accessToken, "authorization", "DPoP " + accessToken},
+			expectedCode:      codes.InvalidArgument,
+			expectedChallenge: `DPoP error="invalid_request"`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			// Arrange
+			ctx := metadata.AppendToOutgoingContext(context.Background(), testCase.metadata...)
+			var trailer metadata.MD
+
+			// Act
+			_, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{}, grpc.Trailer(&trailer))
+
+			// Assert
+			if status.Code(err) != testCase.expectedCode {
+				t.Fatalf("Expected code %v, got %v", testCase.expectedCode, err)
+			}
+			challenges := trailer.Get(grpcdpop.ChallengeMetadataKey)
+			if testCase.expectedChallenge == "" {
+				if len(challenges) != 0 {
+					t.Errorf("Unexpected challenge %v", challenges)
+				}
+				return
+			}
+			if len(challenges) != 1 || !strings.HasPrefix(challenges[0], testCase.expectedChallenge) {
+				t.Errorf("Expected challenge %q, got %v", testCase.expectedChallenge, challenges)
+			}
+		})
+	}
+}
+
+// Test that a stream opened with a valid proof is accepted and that one without a proof is rejected
+func TestStreamServerInterceptor(t *testing.T) {
+	// Arrange
+	keys := newTestKeys(t)
+	accessToken := keys.accessToken(t)
+	conn := newTestConn(t, grpcdpop.ServerOptions{ParseAccessToken: keys.parseAccessToken})
+	client := grpc_health_v1.NewHealthClient(conn)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	validCtx := metadata.AppendToOutgoingContext(ctx,
+		"authorization", "DPoP "+accessToken,
+		"dpop", createTestProof(t, keys.client, testWatchMethod, accessToken, ""),
+	)
+	invalidCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "DPoP "+accessToken)
+
+	// Act
+	valid, err := client.Watch(validCtx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, validErr := valid.Recv()
+	invalid, err := client.Watch(invalidCtx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, invalidErr := invalid.Recv()
+
+	// Assert
+	if validErr != nil || response.GetStatus() != grpc_health_v1.HealthCheckResponse_SERVING {
+		t.Errorf("Expected a serving status, got %v: %v", response, validErr)
+	}
+	if status.Code(invalidErr) != codes.Unauthenticated {
+		t.Errorf("Expected code %v, got %v", codes.Unauthenticated, invalidErr)
+	}
+}
+
+// Test that a call without a server nonce is rejected with a new nonce in the trailer that is then accepted
+func TestUnaryServerInterceptor_Nonce(t *testing.T) {
+	// Arrange
+	keys := newTestKeys(t)
+	accessToken := keys.accessToken(t)
+	nonceIssuer, err := dpop.NewNonceIssuer([][]byte{bytes.Repeat([]byte("a"), dpop.MINIMUM_NONCE_KEY_SIZE)}, dpop.NonceOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := grpc_health_v1.NewHealthClient(newTestConn(t, grpcdpop.ServerOptions{
+		ParseAccessToken: keys.parseAccessToken,
+		NonceIssuer:      nonceIssuer,
+	}))
+	call := func(nonce string, trailer *metadata.MD) error {
+		ctx := metadata.AppendToOutgoingContext(context.Background(),
+			"authorization", "DPoP "+accessToken,
+			"dpop", createTestProof(t, keys.client, testCheckMethod, accessToken, nonce),
+		)
+		_, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{}, grpc.Trailer(trailer))
+		return err
+	}
+
+	// Act
+	var trailer metadata.MD
+	rejectedErr := call("", &trailer)
+	nonces := trailer.Get(grpcdpop.NonceMetadataKey)
+	if len(nonces) != 1 {
+		t.Fatalf("Expected a new nonce, got %v", trailer)
+	}
+	acceptedErr := call(nonces[0], &metadata.MD{})
+
+	// Assert
+	if s, _ := status.FromError(rejectedErr); s.Code() != codes.Unauthenticated || s.Message() != dpop.ErrorCodeUseDPoPNonce {
+		t.Errorf("Expected use_dpop_nonce error, got %v", rejectedErr)
+	}
+	if acceptedErr != nil {
+		t.Errorf("Unexpected error: %v", acceptedErr)
+	}
+}
+
+// Test that the verified proof and access token are available to the handler
+func TestUnaryServerInterceptor_Context(t *testing.T) {
+	// Arrange
+	keys := newTestKeys(t)
+	accessToken := keys.accessToken(t)
+	underTest := grpcdpop.UnaryServerInterceptor(grpcdpop.ServerOptions{
+		ParseAccessToken: keys.parseAccessToken,
+		Authority:        testAuthority,
+	})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"authorization", "DPoP "+accessToken,
+		"dpop", createTestProof(t, keys.client, testCheckMethod, accessToken, ""),
+	))
+	var proof *dpop.Proof
+	var contextAccessToken string
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		proof, _ = dpop.ProofFromContext(ctx)
+		contextAccessToken, _ = dpop.AccessTokenFromContext(ctx)
+		return nil, nil
+	}
+
+	// Act
+	_, err := underTest(ctx, nil, &grpc.UnaryServerInfo{FullMethod: testCheckMethod}, handler)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	jkt, err := dpop.JKT(keys.client.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proof == nil || proof.PublicKey() != jkt || contextAccessToken != accessToken {
+		t.Errorf("Expected the proof and access token in the context, got %v and %q", proof, contextAccessToken)
+	}
+}
+
+// Test that a call is rejected when its access token parses to no token
+func TestUnaryServerInterceptor_NilToken(t *testing.T) {
+	// Arrange
+	keys := newTestKeys(t)
+	accessToken := keys.accessToken(t)
+	underTest := grpcdpop.UnaryServerInterceptor(grpcdpop.ServerOptions{
+		ParseAccessToken: func(ctx context.Context, accessToken string) (dpop.BoundClaims, error) {
+			return nil, nil
+		},
+		Authority: testAuthority,
+	})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"authorization", "DPoP "+accessToken,
+		"dpop", createTestProof(t, keys.client, testCheckMethod, accessToken, ""),
+	))
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	}
+
+	// Act
+	_, err := underTest(ctx, nil, &grpc.UnaryServerInfo{FullMethod: testCheckMethod}, handler)
+
+	// Assert
+	if s, _ := status.FromError(err); s.Code() != codes.Unauthenticated || s.Message() != dpop.ErrorCodeInvalidToken {
+		t.Errorf("Expected invalid_token error, got %v", err)
+	}
+}
+
+// Test that calls with opaque access tokens are validated against their introspection response
+func TestUnaryServerInterceptor_Introspection(t *testing.T) {
+	keys := newTestKeys(t)
+	jkt, err := dpop.JKT(keys.client.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	underTest := grpcdpop.UnaryServerInterceptor(grpcdpop.ServerOptions{
+		ParseAccessToken: func(ctx context.Context, accessToken string) (dpop.BoundClaims, error) {
+			return &dpop.IntrospectionResponse{
+				Active:       accessToken == "active-token",
+				TokenType:    dpop.TokenTypeDPoP,
+				Confirmation: dpop.Confirmation{JWKThumbprint: jkt},
+			}, nil
+		},
+		Authority: testAuthority,
+	})
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	}
+
+	testCases := []struct {
+		accessToken  string
+		expectedCode codes.Code
+	}{
+		{accessToken: "active-token", expectedCode: codes.OK},
+		{accessToken: "inactive-token", expectedCode: codes.Unauthenticated},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.accessToken, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+				"authorization", "DPoP "+testCase.accessToken,
+				"dpop", createTestProof(t, keys.client, testCheckMethod, testCase.accessToken, ""),
+			))
+
+			// Act
+			_, err := underTest(ctx, nil, &grpc.UnaryServerInfo{FullMethod: testCheckMethod}, handler)
+
+			// Assert
+			if code := status.Code(err); code != testCase.expectedCode {
+				t.Errorf("Expected code %v, got %v", testCase.expectedCode, err)
+			}
+		})
+	}
+}
+
+// Test that the interceptors can not be created without a way to verify access tokens
+func TestServerInterceptors_MissingParseAccessToken(t *testing.T) {
+	for name, create := range map[string]func(){
+		"unary":  func() { grpcdpop.UnaryServerInterceptor(grpcdpop.ServerOptions{}) },
+		"stream": func() { grpcdpop.StreamServerInterceptor(grpcdpop.ServerOptions{}) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected a panic")
+				}
+			}()
+
+			// Act
+			create()
+		})
+	}
+}
+
+// Test that a call failing because of a server error is rejected with codes.Internal
+func TestUnaryServerInterceptor_ServerError(t *testing.T) {
+	// Arrange
+	keys := newTestKeys(t)
+	accessToken := keys.accessToken(t)
+	underTest := grpcdpop.UnaryServerInterceptor(grpcdpop.ServerOptions{
+		ParseAccessToken: func(ctx context.Context, accessToken string) (dpop.BoundClaims, error) {
+			return nil, dpop.ErrIntrospectionFailed
+		},
+		Authority: testAuthority,
+	})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"authorization", "DPoP "+accessToken,
+		"dpop", createTestProof(t, keys.client, testCheckMethod, accessToken, ""),
+	))
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	}
+
+	// Act
+	_, err := underTest(ctx, nil, &grpc.UnaryServerInfo{FullMethod: testCheckMethod}, handler)
+
+	// Assert
+	if s, _ := status.FromError(err); s.Code() != codes.Internal || s.Message() != dpop.ErrorCodeServerError {
+		t.Errorf("Expected internal server_error, got %v", err)
+	}
+}
+
+// Test that the `htu` of a call is the URI of the method
+func TestMethodURL(t *testing.T) {
+	// Act
+	u := grpcdpop.MethodURL("device.example.com:8443", "/package.Service/Method")
+
+	// Assert
+	if u.String() != "https://device.example.com:8443/package.Service/Method" {
+		t.Errorf("Unexpected URL %s", u)
+	}
+}
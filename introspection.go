@@ -0,0 +1,291 @@
+package dpop
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const DEFAULT_INTROSPECTION_CACHE_TTL = time.Minute
+const DEFAULT_INTROSPECTION_CACHE_SIZE = 10000
+
+// The token type of DPoP bound access tokens.
+// See https://datatracker.ietf.org/doc/html/rfc9449#section-5
+const TokenTypeDPoP = "DPoP"
+
+// The maximum size of an introspection response that is read.
+const maxIntrospectionResponseSize = 1 << 20
+
+// IntrospectionResponse is the response of a token introspection endpoint.
+// See https://datatracker.ietf.org/doc/html/rfc7662#section-2.2 and https://datatracker.ietf.org/doc/html/rfc9449#section-6.2
+//
+// It implements the BoundClaims interface so that it can be used to validate proofs bound to opaque access tokens.
+type IntrospectionResponse struct {
+	jwt.RegisteredClaims
+
+	// Whether the token is active.
+	Active bool `json:"active"`
+
+	// The type of the token, `DPoP` for DPoP bound access tokens.
+	TokenType string `json:"token_type,omitempty"`
+
+	// The scopes of the token separated by spaces.
+	Scope string `json:"scope,omitempty"`
+
+	// The client the token was issued to.
+	ClientID string `json:"client_id,omitempty"`
+
+	// The resource owner who authorized the token.
+	Username string `json:"username,omitempty"`
+
+	// the `cnf` (Confirmation) claim. See https://datatracker.ietf.org/doc/html/rfc9449#section-6.2
+	Confirmation Confirmation `json:"cnf"`
+}
+
+// Implement the BoundClaims interface.
+func (r *IntrospectionResponse) GetJWKThumbprint() (string, error) {
+	return r.Confirmation.JWKThumbprint, nil
+}
+
+// ValidateIntrospection validates that the proof is bound to the raw access token and to the key
+// in the introspection response of the access token.
+//
+// The token must be active, have a `cnf.jkt` member and, if the response has a token type, it must be `DPoP`.
+// Errors about the introspection response are joined with ErrInvalidToken.
+func (t *Proof) ValidateIntrospection(rawToken string, introspection *IntrospectionResponse) error {
+	if introspection == nil || !introspection.Active {
+		return errors.Join(ErrInvalidToken, ErrInactiveToken)
+	}
+	if introspection.TokenType != "" && !strings.EqualFold(introspection.TokenType, TokenTypeDPoP) {
+		return errors.Join(ErrInvalidToken, ErrIncorrectTokenType)
+	}
+	if introspection.Confirmation.JWKThumbprint == "" {
+		return errors.Join(ErrInvalidToken, ErrIncorrectAccessTokenClaimsType)
+	}
+	return t.ValidateAccessToken(rawToken, introspection)
+}
+
+// IntrospectorOptions and its contents are optional for the NewIntrospector function.
+type IntrospectorOptions struct {
+	// The credentials used to authenticate to the introspection endpoint with HTTP basic authentication.
+	ClientID     string
+	ClientSecret string
+
+	// The client used to send introspection requests. If not set http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// The maximum time a response is cached. If not set the default is 1 minute.
+	// Responses for active tokens are never cached beyond the expiry of the token.
+	CacheTTL *time.Duration
+
+	// The maximum number of cached responses. If not set the default is 10000.
+	CacheSize int
+
+	// Used to get the current time. If not set time.Now is used.
+	Now func() time.Time
+}
+
+// Introspector requests introspection responses for access tokens from an authorization server
+// and caches them, to avoid an introspection request for every request to a protected resource.
+// See https://datatracker.ietf.org/doc/html/rfc7662
+//
+// Responses are cached by the hash of the access token so that raw tokens are not kept in memory.
+// When the cache is full, expired responses at the back of its LRU list are evicted first and,
+// if the cache is still full, the least recently used response is evicted.
+// It is safe for concurrent use.
+type Introspector struct {
+	endpoint     string
+	clientID     string
+	clientSecret string
+	client       *http.Client
+	ttl          time.Duration
+	size         int
+	now          func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type introspectionCacheEntry struct {
+	key      string
+	response *IntrospectionResponse
+	expiry   time.Time
+}
+
+// NewIntrospector creates an Introspector for an introspection endpoint.
+func NewIntrospector(endpoint string, opts IntrospectorOptions) *Introspector {
+	client := http.DefaultClient
+	if opts.HTTPClient != nil {
+		client = opts.HTTPClient
+	}
+	ttl := DEFAULT_INTROSPECTION_CACHE_TTL
+	if opts.CacheTTL != nil {
+		ttl = *opts.CacheTTL
+	}
+	size := DEFAULT_INTROSPECTION_CACHE_SIZE
+	if opts.CacheSize > 0 {
+		size = opts.CacheSize
+	}
+	now := time.Now
+	if opts.Now != nil {
+		now = opts.Now
+	}
+
+	return &Introspector{
+		endpoint:     endpoint,
+		clientID:     opts.ClientID,
+		clientSecret: opts.ClientSecret,
+		client:       client,
+		ttl:          ttl,
+		size:         size,
+		now:          now,
+		entries:      make(map[string]*list.Element),
+		lru:          list.New(),
+	}
+}
+
+// Introspect returns the introspection response of an access token, from the cache if possible.
+//
+// Inactive tokens are returned as responses with Active set to false, errors are only returned
+// if the introspection request fails. Each call returns its own copy of the response.
+func (i *Introspector) Introspect(ctx context.Context, accessToken string) (*IntrospectionResponse, error) {
+	key := AccessTokenHash(accessToken)
+	if response, ok := i.cached(key); ok {
+		return response, nil
+	}
+
+	response, err := i.introspect(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	i.store(key, response.clone())
+	return response, nil
+}
+
+// Sends an introspection request. See https://datatracker.ietf.org/doc/html/rfc7662#section-2.1
+func (i *Introspector) introspect(ctx context.Context, accessToken string) (*IntrospectionResponse, error) {
+	form := url.Values{
+		"token":           {accessToken},
+		"token_type_hint": {"access_token"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.Join(ErrIntrospectionFailed, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if i.clientID != "" {
+		// Credentials are form encoded before they are used for basic authentication.
+		// See https://datatracker.ietf.org/doc/html/rfc6749#section-2.3.1
+		req.SetBasicAuth(url.QueryEscape(i.clientID), url.QueryEscape(i.clientSecret))
+	}
+
+	res, err := i.client.Do(req)
+	if err != nil {
+		return nil, errors.Join(ErrIntrospectionFailed, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Join(ErrIntrospectionFailed, fmt.Errorf("unexpected status code %d", res.StatusCode))
+	}
+
+	response := &IntrospectionResponse{}
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxIntrospectionResponseSize)).Decode(response); err != nil {
+		return nil, errors.Join(ErrIntrospectionFailed, err)
+	}
+	return response, nil
+}
+
+// Returns a copy of a cached response that has not expired.
+func (i *Introspector) cached(key string) (*IntrospectionResponse, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	element, ok := i.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*introspectionCacheEntry)
+	if !i.now().Before(entry.expiry) {
+		i.remove(element)
+		return nil, false
+	}
+	i.lru.MoveToFront(element)
+	return entry.response.clone(), true
+}
+
+// Caches a response until the cache TTL has passed or the token expires.
+func (i *Introspector) store(key string, response *IntrospectionResponse) {
+	now := i.now()
+	expiry := now.Add(i.ttl)
+	if response.Active && response.ExpiresAt != nil && response.ExpiresAt.Before(expiry) {
+		expiry = response.ExpiresAt.Time
+	}
+	if !now.Before(expiry) {
+		return
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if element, ok := i.entries[key]; ok {
+		entry := element.Value.(*introspectionCacheEntry)
+		entry.response = response
+		entry.expiry = expiry
+		i.lru.MoveToFront(element)
+		return
+	}
+	if i.lru.Len() >= i.size {
+		i.evict(now)
+	}
+	i.entries[key] = i.lru.PushFront(&introspectionCacheEntry{key: key, response: response, expiry: expiry})
+}
+
+// Removes expired responses from the back of the list until an unexpired response is found
+// and, if the cache is still full, the least recently used response.
+func (i *Introspector) evict(now time.Time) {
+	for element := i.lru.Back(); element != nil && !now.Before(element.Value.(*introspectionCacheEntry).expiry); element = i.lru.Back() {
+		i.remove(element)
+	}
+
+	for i.lru.Len() >= i.size {
+		i.remove(i.lru.Back())
+	}
+}
+
+func (i *Introspector) remove(element *list.Element) {
+	entry := i.lru.Remove(element).(*introspectionCacheEntry)
+	delete(i.entries, entry.key)
+}
+
+// Returns a copy of the response that does not share any of its claims.
+func (r *IntrospectionResponse) clone() *IntrospectionResponse {
+	c := *r
+	if r.Audience != nil {
+		c.Audience = append(jwt.ClaimStrings{}, r.Audience...)
+	}
+	c.ExpiresAt = cloneNumericDate(r.ExpiresAt)
+	c.NotBefore = cloneNumericDate(r.NotBefore)
+	c.IssuedAt = cloneNumericDate(r.IssuedAt)
+	return &c
+}
+
+func cloneNumericDate(d *jwt.NumericDate) *jwt.NumericDate {
+	if d == nil {
+		return nil
+	}
+	c := *d
+	return &c
+}
@@ -0,0 +1,277 @@
+package dpop_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AxisCommunications/go-dpop"
+)
+
+// Starts an introspection endpoint that responds with the supplied responses by access token
+// and counts the requests it receives.
+func newTestIntrospectionServer(t *testing.T, responses map[string]map[string]interface{}, requests *int32) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		clientID, clientSecret, ok := r.BasicAuth()
+		if !ok || clientID != "resource" || clientSecret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost || r.FormValue("token_type_hint") != "access_token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		response, ok := responses[r.FormValue("token")]
+		if !ok {
+			response = map[string]interface{}{"active": false}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Test that a proof bound to an opaque access token is validated with an introspection response
+func TestIntrospector_ValidateIntrospection(t *testing.T) {
+	// Arrange
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jkt := testThumbprint(t, key)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+	responses := map[string]map[string]interface{}{
+		"valid":     {"active": true, "token_type": "DPoP", "exp": exp, "cnf": map[string]string{"jkt": jkt}},
+		"other key": {"active": true, "token_type": "DPoP", "exp": exp, "cnf": map[string]string{"jkt": testThumbprint(t, otherKey)}},
+		"bearer":    {"active": true, "token_type": "Bearer", "exp": exp},
+		"unbound":   {"active": true, "exp": exp},
+	}
+	var requests int32
+	server := newTestIntrospectionServer(t, responses, &requests)
+	underTest := dpop.NewIntrospector(server.URL, dpop.IntrospectorOptions{ClientID: "resource", ClientSecret: "secret"})
+	u := mustParseURL(t, "https://server.example.com/resource")
+
+	testCases := []struct {
+		accessToken string
+		expected    error
+	}{
+		{accessToken: "valid", expected: nil},
+		{accessToken: "other key", expected: dpop.ErrJWKMismatch},
+		{accessToken: "bearer", expected: dpop.ErrIncorrectTokenType},
+		{accessToken: "unbound", expected: dpop.ErrIncorrectAccessTokenClaimsType},
+		{accessToken: "inactive", expected: dpop.ErrInactiveToken},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.accessToken, func(t *testing.T) {
+			proof, err := dpop.Parse(createTestProof(t, key, dpop.GET, u.String(), testCase.accessToken, ""), dpop.GET, u, dpop.ParseOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Act
+			introspection, err := underTest.Introspect(context.Background(), testCase.accessToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = proof.ValidateIntrospection(testCase.accessToken, introspection)
+
+			// Assert
+			if testCase.expected == nil {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, testCase.expected) {
+				t.Errorf("Expected error %v, got %v", testCase.expected, err)
+			}
+		})
+	}
+}
+
+// Test that introspection responses are cached until the cache TTL has passed
+func TestIntrospector_Cache(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	exp := now.Add(time.Hour).Unix()
+	responses := map[string]map[string]interface{}{
+		"token": {"active": true, "exp": exp, "cnf": map[string]string{"jkt": "jkt"}},
+	}
+	var requests int32
+	server := newTestIntrospectionServer(t, responses, &requests)
+	ttl := time.Minute
+	underTest := dpop.NewIntrospector(server.URL, dpop.IntrospectorOptions{
+		ClientID:     "resource",
+		ClientSecret: "secret",
+		CacheTTL:     &ttl,
+		Now:          func() time.Time { return now },
+	})
+
+	// Act
+	first, err := underTest.Introspect(context.Background(), "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = underTest.Introspect(context.Background(), "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cachedRequests := atomic.LoadInt32(&requests)
+	now = now.Add(ttl)
+	_, err = underTest.Introspect(context.Background(), "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Assert
+	if !first.Active || first.Confirmation.JWKThumbprint != "jkt" {
+		t.Errorf("Unexpected introspection response %+v", first)
+	}
+	if cachedRequests != 1 {
+		t.Errorf("Expected 1 request before the cache expired, got %d", cachedRequests)
+	}
+	if requests := atomic.LoadInt32(&requests); requests != 2 {
+		t.Errorf("Expected 2 requests after the cache expired, got %d", requests)
+	}
+}
+
+// Test that a response is not cached beyond the expiry of the token
+func TestIntrospector_CacheTokenExpiry(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	responses := map[string]map[string]interface{}{
+		"token": {"active": true, "exp": now.Add(10 * time.Second).Unix(), "cnf": map[string]string{"jkt": "jkt"}},
+	}
+	var requests int32
+	server := newTestIntrospectionServer(t, responses, &requests)
+	underTest := dpop.NewIntrospector(server.URL, dpop.IntrospectorOptions{
+		ClientID:     "resource",
+		ClientSecret: "secret",
+		Now:          func() time.Time { return now },
+	})
+
+	// Act
+	_, err := underTest.Introspect(context.Background(), "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(10 * time.Second)
+	_, err = underTest.Introspect(context.Background(), "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Assert
+	if requests := atomic.LoadInt32(&requests); requests != 2 {
+		t.Errorf("Expected 2 requests, got %d", requests)
+	}
+}
+
+// Test that a failed introspection request is returned as an error and not cached
+func TestIntrospector_Failure(t *testing.T) {
+	// Arrange
+	var requests int32
+	server := newTestIntrospectionServer(t, nil, &requests)
+	underTest := dpop.NewIntrospector(server.URL, dpop.IntrospectorOptions{ClientID: "resource", ClientSecret: "wrong"})
+
+	// Act
+	_, err := underTest.Introspect(context.Background(), "token")
+	_, secondErr := underTest.Introspect(context.Background(), "token")
+
+	// Assert
+	if !errors.Is(err, dpop.ErrIntrospectionFailed) || !errors.Is(secondErr, dpop.ErrIntrospectionFailed) {
+		t.Errorf("Expected error %v, got %v and %v", dpop.ErrIntrospectionFailed, err, secondErr)
+	}
+	if requests := atomic.LoadInt32(&requests); requests != 2 {
+		t.Errorf("Expected 2 requests, got %d", requests)
+	}
+}
+
+// Test that the least recently used response is evicted when the cache is full
+func TestIntrospector_CacheEviction(t *testing.T) {
+	// Arrange
+	var requests int32
+	server := newTestIntrospectionServer(t, nil, &requests)
+	underTest := dpop.NewIntrospector(server.URL, dpop.IntrospectorOptions{
+		ClientID:     "resource",
+		ClientSecret: "secret",
+		CacheSize:    2,
+	})
+	for _, accessToken := range []string{"first", "second", "first", "third"} {
+		if _, err := underTest.Introspect(context.Background(), accessToken); err != nil {
+			t.Fatal(err)
+		}
+	}
+	beforeEviction := atomic.LoadInt32(&requests)
+
+	// Act
+	_, err := underTest.Introspect(context.Background(), "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cachedRequests := atomic.LoadInt32(&requests)
+	_, err = underTest.Introspect(context.Background(), "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Assert
+	if beforeEviction != 3 || cachedRequests != 3 {
+		t.Errorf("Expected the recently used response to be cached, got %d and %d requests", beforeEviction, cachedRequests)
+	}
+	if requests := atomic.LoadInt32(&requests); requests != 4 {
+		t.Errorf("Expected the least recently used response to be evicted, got %d requests", requests)
+	}
+}
+
+// Test that changes to a returned response do not affect the cached response
+func TestIntrospector_CacheCopy(t *testing.T) {
+	// Arrange
+	responses := map[string]map[string]interface{}{
+		"token": {"active": true, "aud": []string{"resource"}, "cnf": map[string]string{"jkt": "jkt"}},
+	}
+	var requests int32
+	server := newTestIntrospectionServer(t, responses, &requests)
+	underTest := dpop.NewIntrospector(server.URL, dpop.IntrospectorOptions{ClientID: "resource", ClientSecret: "secret"})
+	first, err := underTest.Introspect(context.Background(), "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Active = false
+	first.Audience[0] = "other"
+	second, err := underTest.Introspect(context.Background(), "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.Confirmation.JWKThumbprint = "other"
+
+	// Act
+	third, err := underTest.Introspect(context.Background(), "token")
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !third.Active || third.Audience[0] != "resource" || third.Confirmation.JWKThumbprint != "jkt" {
+		t.Errorf("Unexpected introspection response %+v", third)
+	}
+	if requests := atomic.LoadInt32(&requests); requests != 1 {
+		t.Errorf("Expected 1 request, got %d", requests)
+	}
+}
@@ -0,0 +1,233 @@
+package dpop
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+)
+
+// JWK is a public JSON Web Key as used in the `jwk` header of a proof.
+// See https://datatracker.ietf.org/doc/html/rfc7517
+//
+// Only the members needed to represent EC (P-256, P-384, P-521), RSA and OKP (Ed25519) public keys are kept,
+// any other members are dropped when a JWK is unmarshalled.
+type JWK struct {
+	// The key type, "EC", "RSA" or "OKP".
+	Kty string `json:"kty"`
+
+	// The curve of EC and OKP keys.
+	Crv string `json:"crv,omitempty"`
+
+	// The x coordinate of EC keys or the public key of OKP keys.
+	X string `json:"x,omitempty"`
+
+	// The y coordinate of EC keys.
+	Y string `json:"y,omitempty"`
+
+	// The modulus of RSA keys.
+	N string `json:"n,omitempty"`
+
+	// The exponent of RSA keys.
+	E string `json:"e,omitempty"`
+
+	// The optional key ID, it is not part of the thumbprint.
+	Kid string `json:"kid,omitempty"`
+}
+
+// FromPublicKey creates a JWK from an *ecdsa.PublicKey, *rsa.PublicKey or ed25519.PublicKey.
+func FromPublicKey(publicKey crypto.PublicKey) (*JWK, error) {
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256(), elliptic.P384(), elliptic.P521():
+		default:
+			return nil, ErrUnsupportedCurve
+		}
+
+		// Calculate the size of the byte array representation of an elliptic curve coordinate
+		// and ensure that the byte array representation of the key is padded correctly.
+		keyCurveBytesSize := (key.Curve.Params().BitSize + 7) / 8
+
+		return &JWK{
+			Kty: "EC",
+			Crv: key.Curve.Params().Name,
+			X:   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, keyCurveBytesSize))),
+			Y:   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, keyCurveBytesSize))),
+		}, nil
+	case *rsa.PublicKey:
+		return &JWK{
+			Kty: "RSA",
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return &JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key),
+		}, nil
+	}
+	return nil, ErrUnsupportedKeyAlgorithm
+}
+
+// PublicKey returns the key as an *ecdsa.PublicKey, *rsa.PublicKey or ed25519.PublicKey.
+//
+// The key is validated, EC points must lie on their curve and RSA exponents must be usable by the crypto/rsa package.
+func (j *JWK) PublicKey() (crypto.PublicKey, error) {
+	switch j.Kty {
+	case "EC":
+		if j.X == "" || j.Y == "" || j.Crv == "" {
+			return nil, ErrInvalidJWK
+		}
+
+		// Decode the coordinates from Base64.
+		//
+		// According to RFC 7518, they are Base64 URL unsigned integers.
+		// https://tools.ietf.org/html/rfc7518#section-6.3
+		xCoordinate, err := base64urlTrailingPadding(j.X)
+		if err != nil {
+			return nil, errors.Join(ErrInvalidJWK, err)
+		}
+		yCoordinate, err := base64urlTrailingPadding(j.Y)
+		if err != nil {
+			return nil, errors.Join(ErrInvalidJWK, err)
+		}
+
+		// Read the specified curve of the key.
+		var curve elliptic.Curve
+		var ecdhCurve ecdh.Curve
+		switch j.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+			ecdhCurve = ecdh.P256()
+		case "P-384":
+			curve = elliptic.P384()
+			ecdhCurve = ecdh.P384()
+		case "P-521":
+			curve = elliptic.P521()
+			ecdhCurve = ecdh.P521()
+		default:
+			return nil, ErrUnsupportedCurve
+		}
+
+		// Ensure that the coordinates have the full length of the curve and that the point lies on the curve.
+		// See https://datatracker.ietf.org/doc/html/rfc7518#section-6.2.1.2
+		keyCurveBytesSize := (curve.Params().BitSize + 7) / 8
+		if len(xCoordinate) != keyCurveBytesSize || len(yCoordinate) != keyCurveBytesSize {
+			return nil, ErrInvalidCurvePoint
+		}
+		uncompressedPoint := append([]byte{4}, xCoordinate...)
+		uncompressedPoint = append(uncompressedPoint, yCoordinate...)
+		if _, err := ecdhCurve.NewPublicKey(uncompressedPoint); err != nil {
+			return nil, errors.Join(ErrInvalidCurvePoint, err)
+		}
+
+		return &ecdsa.PublicKey{
+			X:     big.NewInt(0).SetBytes(xCoordinate),
+			Y:     big.NewInt(0).SetBytes(yCoordinate),
+			Curve: curve,
+		}, nil
+	case "RSA":
+		if j.E == "" || j.N == "" {
+			return nil, ErrInvalidJWK
+		}
+
+		// Decode the exponent and modulus from Base64.
+		//
+		// According to RFC 7518, they are Base64 URL unsigned integers.
+		// https://tools.ietf.org/html/rfc7518#section-6.3
+		exponent, err := base64urlTrailingPadding(j.E)
+		if err != nil {
+			return nil, errors.Join(ErrInvalidJWK, err)
+		}
+		modulus, err := base64urlTrailingPadding(j.N)
+		if err != nil {
+			return nil, errors.Join(ErrInvalidJWK, err)
+		}
+
+		// Ensure that the exponent is an odd number larger than one that fits in 32 bits,
+		// which is the range accepted by the crypto/rsa package.
+		publicExponent := big.NewInt(0).SetBytes(exponent)
+		if !publicExponent.IsInt64() || publicExponent.Int64() < 3 || publicExponent.Int64() > 1<<31-1 || publicExponent.Bit(0) == 0 {
+			return nil, ErrInvalidRSAExponent
+		}
+
+		return &rsa.PublicKey{
+			N: big.NewInt(0).SetBytes(modulus),
+			E: int(publicExponent.Int64()),
+		}, nil
+	case "OKP":
+		if j.X == "" {
+			return nil, ErrInvalidJWK
+		}
+		// Proofs created by earlier versions of this package omit the curve.
+		if j.Crv != "" && j.Crv != "Ed25519" {
+			return nil, ErrUnsupportedCurve
+		}
+
+		publicKey, err := base64urlTrailingPadding(j.X)
+		if err != nil {
+			return nil, errors.Join(ErrInvalidJWK, err)
+		}
+		if len(publicKey) != ed25519.PublicKeySize {
+			return nil, ErrInvalidJWK
+		}
+
+		return ed25519.PublicKey(publicKey), nil
+	}
+	return nil, ErrUnsupportedKeyAlgorithm
+}
+
+// Thumbprint returns the base64url encoded JWK thumbprint of the key computed with the supplied hash.
+// See https://datatracker.ietf.org/doc/html/rfc7638
+//
+// The SHA-256 thumbprint is the value used for the `jkt` confirmation claim of bound access tokens
+// and the `dpop_jkt` authorization request parameter. See https://datatracker.ietf.org/doc/html/rfc9449#section-6.1
+func (j *JWK) Thumbprint(hash crypto.Hash) (string, error) {
+	if !hash.Available() {
+		return "", ErrUnsupportedHash
+	}
+
+	b, err := j.thumbprintInput()
+	if err != nil {
+		return "", err
+	}
+
+	h := hash.New()
+	h.Write(b)
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// Returns the JSON representation of the required members of the key in lexicographic order.
+// The key is parsed and recreated so that the members are encoded in their canonical form.
+// See https://datatracker.ietf.org/doc/html/rfc7638#section-3.2
+func (j *JWK) thumbprintInput() ([]byte, error) {
+	publicKey, err := j.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	canonical, err := FromPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var members map[string]string
+	switch canonical.Kty {
+	case "EC":
+		members = map[string]string{"crv": canonical.Crv, "kty": canonical.Kty, "x": canonical.X, "y": canonical.Y}
+	case "RSA":
+		members = map[string]string{"e": canonical.E, "kty": canonical.Kty, "n": canonical.N}
+	case "OKP":
+		members = map[string]string{"crv": canonical.Crv, "kty": canonical.Kty, "x": canonical.X}
+	}
+
+	// Maps are marshalled with their keys sorted and without whitespace.
+	return json.Marshal(members)
+}
@@ -0,0 +1,183 @@
+package dpop_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/AxisCommunications/go-dpop"
+)
+
+// Test that the thumbprint matches the example in https://datatracker.ietf.org/doc/html/rfc7638#section-3.1
+func TestJWK_ThumbprintRFC7638(t *testing.T) {
+	// Arrange
+	jwkJSON := `{
+		"kty": "RSA",
+		"n": "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		"e": "AQAB",
+		"alg": "RS256",
+		"kid": "2011-04-29"
+	}`
+	jwk := &dpop.JWK{}
+	if err := json.Unmarshal([]byte(jwkJSON), jwk); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	thumbprint, err := jwk.Thumbprint(crypto.SHA256)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thumbprint != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Errorf("Unexpected thumbprint %q", thumbprint)
+	}
+	if jwk.Kid != "2011-04-29" {
+		t.Errorf("Expected kid to be unmarshalled")
+	}
+}
+
+// Test that keys survive a round trip through FromPublicKey, JSON and PublicKey
+func TestJWK_RoundTrip(t *testing.T) {
+	// Arrange
+	ecKey, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name string
+		key  crypto.PublicKey
+	}{
+		{name: "EC", key: &ecKey.PublicKey},
+		{name: "RSA", key: &rsaKey.PublicKey},
+		{name: "OKP", key: edKey},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			// Act
+			jwk, err := dpop.FromPublicKey(testCase.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := json.Marshal(jwk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			unmarshalled := &dpop.JWK{}
+			if err := json.Unmarshal(b, unmarshalled); err != nil {
+				t.Fatal(err)
+			}
+			publicKey, err := unmarshalled.PublicKey()
+
+			// Assert
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !publicKey.(interface{ Equal(crypto.PublicKey) bool }).Equal(testCase.key) {
+				t.Errorf("Expected key to survive the round trip")
+			}
+			if unmarshalled.Kty != testCase.name {
+				t.Errorf("Expected kty %s, got %s", testCase.name, unmarshalled.Kty)
+			}
+		})
+	}
+}
+
+// Test that the thumbprint of a JWK matches the public key of a proof signed with the key
+func TestJWK_ThumbprintMatchesProof(t *testing.T) {
+	// Arrange
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := mustParseURL(t, "https://server.example.com/resource")
+	proofString := createTestProof(t, key, "GET", u.String(), "", "")
+	proof, err := dpop.Parse(proofString, dpop.GET, u, dpop.ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := dpop.FromPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	thumbprint, err := jwk.Thumbprint(crypto.SHA256)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thumbprint != proof.PublicKey() {
+		t.Errorf("Expected thumbprint %s to match proof public key %s", thumbprint, proof.PublicKey())
+	}
+}
+
+// Test that invalid JWKs are rejected
+func TestJWK_Invalid(t *testing.T) {
+	testCases := []struct {
+		name     string
+		jwk      dpop.JWK
+		expected error
+	}{
+		{name: "missing members", jwk: dpop.JWK{Kty: "EC", Crv: "P-256"}, expected: dpop.ErrInvalidJWK},
+		{name: "unknown key type", jwk: dpop.JWK{Kty: "oct"}, expected: dpop.ErrUnsupportedKeyAlgorithm},
+		{name: "unsupported curve", jwk: dpop.JWK{Kty: "OKP", Crv: "X25519", X: "AAAA"}, expected: dpop.ErrUnsupportedCurve},
+		{name: "short OKP key", jwk: dpop.JWK{Kty: "OKP", Crv: "Ed25519", X: "AAAA"}, expected: dpop.ErrInvalidJWK},
+		{name: "invalid base64", jwk: dpop.JWK{Kty: "RSA", N: "!", E: "AQAB"}, expected: dpop.ErrInvalidJWK},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			// Act
+			_, err := testCase.jwk.PublicKey()
+			_, thumbprintErr := testCase.jwk.Thumbprint(crypto.SHA256)
+
+			// Assert
+			if !errors.Is(err, testCase.expected) {
+				t.Errorf("Expected error %v, got %v", testCase.expected, err)
+			}
+			if !errors.Is(thumbprintErr, testCase.expected) {
+				t.Errorf("Expected thumbprint error %v, got %v", testCase.expected, thumbprintErr)
+			}
+		})
+	}
+}
+
+// Test that an unavailable hash function is rejected
+func TestJWK_ThumbprintUnavailableHash(t *testing.T) {
+	// Arrange
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := dpop.FromPublicKey(edKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	_, err = jwk.Thumbprint(crypto.MD4)
+
+	// Assert
+	if !errors.Is(err, dpop.ErrUnsupportedHash) {
+		t.Errorf("Expected error %v, got %v", dpop.ErrUnsupportedHash, err)
+	}
+}
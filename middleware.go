@@ -0,0 +1,140 @@
+package dpop
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+type contextKey int
+
+const (
+	proofContextKey contextKey = iota
+	accessTokenContextKey
+)
+
+// MiddlewareOptions configures the Middleware function.
+type MiddlewareOptions struct {
+	// Options used when parsing the proof of a request.
+	ParseOptions ParseOptions
+
+	// Verifies the access token of a request and returns its claims. It is required.
+	// Claims of the *IntrospectionResponse type are validated with Proof.ValidateIntrospection, other claims with Proof.ValidateAccessToken.
+	// Any error returned causes the request to be rejected with an `invalid_token` error, except ErrIntrospectionFailed which is a `server_error`.
+	ParseAccessToken func(r *http.Request, accessToken string) (BoundClaims, error)
+
+	// Used to issue and verify server nonces. If set it is used as ParseOptions.NonceVerifier
+	// and a new nonce is sent in the `DPoP-Nonce` header when a request is rejected because of its nonce.
+	NonceIssuer *NonceIssuer
+}
+
+// Middleware protects a resource with DPoP bound access tokens.
+//
+// It reads the `DPoP` access token from the `Authorization` header and the proof from the `DPoP` header,
+// parses the proof with ParseRequest and validates that it is bound to the access token.
+// Rejected requests get a response with a `WWW-Authenticate: DPoP` challenge according to
+// https://datatracker.ietf.org/doc/html/rfc9449#section-7.1
+//
+// The verified proof and access token are available to the next handler through ProofFromContext and AccessTokenFromContext.
+// Middleware panics if opts.ParseAccessToken is not set.
+func Middleware(next http.Handler, opts MiddlewareOptions) http.Handler {
+	if opts.ParseAccessToken == nil {
+		panic("dpop: MiddlewareOptions.ParseAccessToken is required")
+	}
+	parseOptions := opts.ParseOptions
+	if opts.NonceIssuer != nil {
+		parseOptions.NonceVerifier = opts.NonceIssuer
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accessToken, err := accessTokenFromRequest(r)
+		if err != nil {
+			writeChallenge(w, parseOptions, opts.NonceIssuer, err)
+			return
+		}
+
+		proof, err := ParseRequest(r, parseOptions)
+		if err != nil {
+			writeChallenge(w, parseOptions, opts.NonceIssuer, err)
+			return
+		}
+
+		boundClaims, err := opts.ParseAccessToken(r, accessToken)
+		if err != nil {
+			writeChallenge(w, parseOptions, opts.NonceIssuer, errors.Join(ErrInvalidToken, err))
+			return
+		}
+		if boundClaims == nil {
+			writeChallenge(w, parseOptions, opts.NonceIssuer, ErrInvalidToken)
+			return
+		}
+		if err := validateBoundClaims(proof, accessToken, boundClaims); err != nil {
+			writeChallenge(w, parseOptions, opts.NonceIssuer, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), proof, accessToken)))
+	})
+}
+
+// NewContext returns a copy of ctx that carries a verified proof and the access token it is bound to.
+// It allows servers for other protocols than HTTP to expose them through ProofFromContext and AccessTokenFromContext.
+func NewContext(ctx context.Context, proof *Proof, accessToken string) context.Context {
+	ctx = context.WithValue(ctx, proofContextKey, proof)
+	return context.WithValue(ctx, accessTokenContextKey, accessToken)
+}
+
+// ProofFromContext returns the proof verified by Middleware or stored with NewContext.
+func ProofFromContext(ctx context.Context) (*Proof, bool) {
+	proof, ok := ctx.Value(proofContextKey).(*Proof)
+	return proof, ok
+}
+
+// AccessTokenFromContext returns the access token verified by Middleware or stored with NewContext.
+func AccessTokenFromContext(ctx context.Context) (string, bool) {
+	accessToken, ok := ctx.Value(accessTokenContextKey).(string)
+	return accessToken, ok
+}
+
+// Validates the binding of the proof to an access token with the supplied claims.
+// Introspection responses are also checked to be active DPoP tokens.
+func validateBoundClaims(proof *Proof, accessToken string, boundClaims BoundClaims) error {
+	if introspection, ok := boundClaims.(*IntrospectionResponse); ok {
+		return proof.ValidateIntrospection(accessToken, introspection)
+	}
+	return proof.ValidateAccessToken(accessToken, boundClaims)
+}
+
+// Reads a `DPoP` access token from the `Authorization` header.
+// See https://datatracker.ietf.org/doc/html/rfc9449#section-7.1
+func accessTokenFromRequest(r *http.Request) (string, error) {
+	authorizations := r.Header.Values("Authorization")
+	if len(authorizations) == 0 {
+		return "", ErrMissingAccessToken
+	}
+	if len(authorizations) > 1 {
+		return "", ErrInvalidRequest
+	}
+
+	scheme, accessToken, ok := strings.Cut(authorizations[0], " ")
+	if !ok || !strings.EqualFold(scheme, "DPoP") {
+		return "", ErrMissingAccessToken
+	}
+	accessToken = strings.TrimSpace(accessToken)
+	if accessToken == "" {
+		return "", ErrInvalidRequest
+	}
+	return accessToken, nil
+}
+
+// Writes a rejection of a request to a protected resource.
+func writeChallenge(w http.ResponseWriter, opts ParseOptions, nonceIssuer *NonceIssuer, err error) {
+	responseOptions := ErrorResponseOptions{AllowedAlgorithms: opts.AllowedAlgorithms}
+	if nonceIssuer != nil && ErrorCode(err) == ErrorCodeUseDPoPNonce {
+		if nonce, err := nonceIssuer.Issue(); err == nil {
+			responseOptions.Nonce = nonce
+		}
+	}
+	WriteError(w, err, responseOptions)
+}
@@ -0,0 +1,253 @@
+package dpop_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AxisCommunications/go-dpop"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Helper function to create a proof signed with the supplied key.
+func createTestProof(t *testing.T, key crypto.Signer, method dpop.HTTPVerb, url string, accessToken string, nonce string) string {
+	t.Helper()
+	ath := ""
+	if accessToken != "" {
+		ath = dpop.AccessTokenHash(accessToken)
+	}
+	proof, err := dpop.Create(jwt.SigningMethodES256, &dpop.ProofTokenClaims{
+		RegisteredClaims: &jwt.RegisteredClaims{
+			ID:       randomTestID(t),
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+		Method:          method,
+		URL:             url,
+		AccessTokenHash: ath,
+		Nonce:           nonce,
+	}, key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return proof
+}
+
+// Helper function to create a random `jti`.
+func randomTestID(t *testing.T) string {
+	t.Helper()
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Helper function to get the thumbprint of a key as it is calculated for a parsed proof.
+func testThumbprint(t *testing.T, key crypto.Signer) string {
+	t.Helper()
+	proof, err := dpop.Parse(createTestProof(t, key, dpop.GET, "https://server.example.com/", "", ""), dpop.GET,
+		mustParseURL(t, "https://server.example.com/"), dpop.ParseOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return proof.PublicKey()
+}
+
+func TestMiddleware(t *testing.T) {
+	// Arrange
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	jkt := testThumbprint(t, privateKey)
+	resourceURL := "https://server.example.com/resource"
+
+	opts := dpop.MiddlewareOptions{
+		ParseAccessToken: func(r *http.Request, accessToken string) (dpop.BoundClaims, error) {
+			if accessToken == "unparsed-token" {
+				return nil, nil
+			}
+			if accessToken == "active-opaque-token" || accessToken == "inactive-opaque-token" {
+				return &dpop.IntrospectionResponse{
+					Active:       accessToken == "active-opaque-token",
+					TokenType:    dpop.TokenTypeDPoP,
+					Confirmation: dpop.Confirmation{JWKThumbprint: jkt},
+				}, nil
+			}
+			if accessToken != "valid-token" {
+				return nil, errors.New("unknown token")
+			}
+			return &dpop.BoundAccessTokenClaims{
+				Confirmation: dpop.Confirmation{JWKThumbprint: jkt},
+			}, nil
+		},
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proof, ok := dpop.ProofFromContext(r.Context())
+		if !ok || proof.PublicKey() != jkt {
+			t.Errorf("Expected proof in context")
+		}
+		accessToken, ok := dpop.AccessTokenFromContext(r.Context())
+		if !ok || (accessToken != "valid-token" && accessToken != "active-opaque-token") {
+			t.Errorf("Expected access token in context")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	underTest := dpop.Middleware(next, opts)
+
+	testCases := map[string]struct {
+		authorization string
+		proof         string
+		status        int
+		challenge     string
+	}{
+		"valid": {
+			authorization: "DPoP valid-token",
+			proof:         createTestProof(t, privateKey, dpop.GET, resourceURL, "valid-token", ""),
+			status:        http.StatusNoContent,
+		},
+		"missing authorization": {
+			proof:     createTestProof(t, privateKey, dpop.GET, resourceURL, "valid-token", ""),
+			status:    http.StatusUnauthorized,
+			challenge: "DPoP algs=",
+		},
+		"bearer authorization": {
+			authorization: "Bearer valid-token",
+			proof:         createTestProof(t, privateKey, dpop.GET, resourceURL, "valid-token", ""),
+			status:        http.StatusUnauthorized,
+			challenge:     "DPoP algs=",
+		},
+		"missing proof": {
+			authorization: "DPoP valid-token",
+			status:        http.StatusUnauthorized,
+			challenge:     "DPoP error=\"invalid_dpop_proof\"",
+		},
+		"proof for other target": {
+			authorization: "DPoP valid-token",
+			proof:         createTestProof(t, privateKey, dpop.POST, resourceURL, "valid-token", ""),
+			status:        http.StatusUnauthorized,
+			challenge:     "DPoP error=\"invalid_dpop_proof\"",
+		},
+		"proof for other token": {
+			authorization: "DPoP valid-token",
+			proof:         createTestProof(t, privateKey, dpop.GET, resourceURL, "other-token", ""),
+			status:        http.StatusUnauthorized,
+			challenge:     "DPoP error=\"invalid_dpop_proof\"",
+		},
+		"proof with other key": {
+			authorization: "DPoP valid-token",
+			proof:         createTestProof(t, otherKey, dpop.GET, resourceURL, "valid-token", ""),
+			status:        http.StatusUnauthorized,
+			challenge:     "DPoP error=\"invalid_dpop_proof\"",
+		},
+		"invalid token": {
+			authorization: "DPoP invalid-token",
+			proof:         createTestProof(t, privateKey, dpop.GET, resourceURL, "invalid-token", ""),
+			status:        http.StatusUnauthorized,
+			challenge:     "DPoP error=\"invalid_token\"",
+		},
+		"unparsed token": {
+			authorization: "DPoP unparsed-token",
+			proof:         createTestProof(t, privateKey, dpop.GET, resourceURL, "unparsed-token", ""),
+			status:        http.StatusUnauthorized,
+			challenge:     "DPoP error=\"invalid_token\"",
+		},
+		"active introspected token": {
+			authorization: "DPoP active-opaque-token",
+			proof:         createTestProof(t, privateKey, dpop.GET, resourceURL, "active-opaque-token", ""),
+			status:        http.StatusNoContent,
+		},
+		"inactive introspected token": {
+			authorization: "DPoP inactive-opaque-token",
+			proof:         createTestProof(t, privateKey, dpop.GET, resourceURL, "inactive-opaque-token", ""),
+			status:        http.StatusUnauthorized,
+			challenge:     "DPoP error=\"invalid_token\"",
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", resourceURL, nil)
+			if testCase.authorization != "" {
+				r.Header.Set("Authorization", testCase.authorization)
+			}
+			if testCase.proof != "" {
+				r.Header.Set("DPoP", testCase.proof)
+			}
+			w := httptest.NewRecorder()
+
+			// Act
+			underTest.ServeHTTP(w, r)
+
+			// Assert
+			if w.Code != testCase.status {
+				t.Errorf("Expected status %d, got %d", testCase.status, w.Code)
+			}
+			challenge := w.Header().Get("WWW-Authenticate")
+			if !strings.HasPrefix(challenge, testCase.challenge) {
+				t.Errorf("Expected challenge %q, got %q", testCase.challenge, challenge)
+			}
+		})
+	}
+}
+
+// Test that a request without a valid nonce is rejected with a new nonce
+func TestMiddleware_Nonce(t *testing.T) {
+	// Arrange
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	nonceIssuer, err := dpop.NewNonceIssuer([][]byte{nonceKeyA}, dpop.NonceOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	underTest := dpop.Middleware(http.NotFoundHandler(), dpop.MiddlewareOptions{
+		ParseAccessToken: func(r *http.Request, accessToken string) (dpop.BoundClaims, error) {
+			return nil, errors.New("not reached")
+		},
+		NonceIssuer: nonceIssuer,
+	})
+	r := httptest.NewRequest("GET", "https://server.example.com/resource", nil)
+	r.Header.Set("Authorization", "DPoP token")
+	r.Header.Set("DPoP", createTestProof(t, privateKey, dpop.GET, "https://server.example.com/resource", "token", ""))
+	w := httptest.NewRecorder()
+
+	// Act
+	underTest.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if challenge := w.Header().Get("WWW-Authenticate"); !strings.HasPrefix(challenge, "DPoP error=\"use_dpop_nonce\"") {
+		t.Errorf("Unexpected challenge %q", challenge)
+	}
+	if err := nonceIssuer.Verify(w.Header().Get("DPoP-Nonce")); err != nil {
+		t.Errorf("Expected a valid nonce: %v", err)
+	}
+}
+
+// Test that the middleware can not be created without a way to verify access tokens
+func TestMiddleware_MissingParseAccessToken(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected a panic")
+		}
+	}()
+
+	// Act
+	dpop.Middleware(http.NotFoundHandler(), dpop.MiddlewareOptions{})
+}
@@ -0,0 +1,178 @@
+package dpop
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"time"
+)
+
+const DEFAULT_NONCE_LIFETIME = time.Minute * 5
+const MINIMUM_NONCE_KEY_SIZE = 32
+
+const (
+	nonceTimestampSize = 8
+	nonceRandomSize    = 16
+	nonceTagSize       = sha256.Size
+	nonceSize          = nonceTimestampSize + nonceRandomSize + nonceTagSize
+)
+
+// NonceVerifier verifies the `nonce` claim of a proof.
+//
+// When set in ParseOptions the Parse function rejects proofs with a `nonce` that does not verify with a ErrIncorrectNonce error.
+// Verify must return ErrInvalidNonce or ErrNonceExpired for such nonces.
+// Any other error, such as a failure to read the nonce keys, is returned by Parse as is.
+type NonceVerifier interface {
+	Verify(nonce string) error
+}
+
+// ExpiringNonceVerifier is a NonceVerifier whose nonces are valid for a limited time after being issued, such as NonceIssuer.
+//
+// When ParseOptions.NonceHasTimestamp is set, proofs are accepted for as long as their nonce verifies,
+// so Parse keeps the `jti` of accepted proofs in the replay cache for the lifetime of their nonce.
+type ExpiringNonceVerifier interface {
+	NonceVerifier
+
+	// Lifetime returns the time a nonce is valid after being issued.
+	Lifetime() time.Duration
+}
+
+// NonceOptions and its contents are optional for the NewNonceIssuer function.
+type NonceOptions struct {
+	// The time a nonce is valid after being issued. If not set the default is 5 minutes.
+	Lifetime *time.Duration
+
+	// Used to get the current time. If not set time.Now is used.
+	Now func() time.Time
+}
+
+// NonceIssuer issues and verifies stateless server nonces as described in https://datatracker.ietf.org/doc/html/rfc9449#section-8
+//
+// A nonce contains the time it was issued and is authenticated with HMAC-SHA256,
+// so any server that shares the keys can verify it without keeping state.
+// As the nonce contains a server managed timestamp ParseOptions.NonceHasTimestamp can be set when it is used.
+type NonceIssuer struct {
+	keys     NonceKeySource
+	lifetime time.Duration
+	now      func() time.Time
+}
+
+// NonceKeySource provides the keys used by a NonceIssuer.
+//
+// The first key is used to issue nonces while all keys are used to verify nonces.
+type NonceKeySource interface {
+	NonceKeys() ([][]byte, error)
+}
+
+type staticNonceKeys [][]byte
+
+func (k staticNonceKeys) NonceKeys() ([][]byte, error) {
+	return k, nil
+}
+
+// NewNonceIssuer creates a NonceIssuer.
+//
+// The first key is used to issue nonces while all keys are used to verify nonces.
+// This allows keys to be rotated by adding a new key first and removing the oldest key once its nonces have expired.
+// Each key needs to be at least MINIMUM_NONCE_KEY_SIZE bytes.
+func NewNonceIssuer(keys [][]byte, opts NonceOptions) (*NonceIssuer, error) {
+	if len(keys) == 0 {
+		return nil, ErrMissingNonceKey
+	}
+	for _, key := range keys {
+		if len(key) < MINIMUM_NONCE_KEY_SIZE {
+			return nil, ErrNonceKeyTooShort
+		}
+	}
+
+	return NewNonceIssuerWithKeySource(staticNonceKeys(keys), opts), nil
+}
+
+// NewNonceIssuerWithKeySource creates a NonceIssuer that reads its keys from a NonceKeySource, such as a NonceKeyRing.
+func NewNonceIssuerWithKeySource(keys NonceKeySource, opts NonceOptions) *NonceIssuer {
+	lifetime := DEFAULT_NONCE_LIFETIME
+	if opts.Lifetime != nil {
+		lifetime = *opts.Lifetime
+	}
+	now := time.Now
+	if opts.Now != nil {
+		now = opts.Now
+	}
+
+	return &NonceIssuer{
+		keys:     keys,
+		lifetime: lifetime,
+		now:      now,
+	}
+}
+
+// Issue creates a new nonce that should be sent to the client in the `DPoP-Nonce` header.
+func (n *NonceIssuer) Issue() (string, error) {
+	keys, err := n.keys.NonceKeys()
+	if err != nil {
+		return "", err
+	}
+	if len(keys) == 0 {
+		return "", ErrMissingNonceKey
+	}
+
+	payload := make([]byte, nonceTimestampSize+nonceRandomSize)
+	binary.BigEndian.PutUint64(payload, uint64(n.now().Unix()))
+	if _, err := rand.Read(payload[nonceTimestampSize:]); err != nil {
+		return "", err
+	}
+
+	nonce := append(payload, nonceTag(keys[0], payload)...)
+	return base64.RawURLEncoding.EncodeToString(nonce), nil
+}
+
+// Implement the ExpiringNonceVerifier interface.
+func (n *NonceIssuer) Lifetime() time.Duration {
+	return n.lifetime
+}
+
+// Implement the NonceVerifier interface.
+//
+// Verify checks that the nonce was issued with one of the keys of the issuer and that it has not expired.
+func (n *NonceIssuer) Verify(nonce string) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil || len(decoded) != nonceSize {
+		return ErrInvalidNonce
+	}
+	payload, tag := decoded[:nonceTimestampSize+nonceRandomSize], decoded[nonceTimestampSize+nonceRandomSize:]
+
+	keys, err := n.keys.NonceKeys()
+	if err != nil {
+		return err
+	}
+
+	authenticated := false
+	for _, key := range keys {
+		if hmac.Equal(tag, nonceTag(key, payload)) {
+			authenticated = true
+			break
+		}
+	}
+	if !authenticated {
+		return ErrInvalidNonce
+	}
+
+	issuedAt := time.Unix(int64(binary.BigEndian.Uint64(payload)), 0)
+	age := n.now().Sub(issuedAt)
+	if age > n.lifetime {
+		return ErrNonceExpired
+	}
+	if age < -n.lifetime {
+		return ErrInvalidNonce
+	}
+
+	return nil
+}
+
+func nonceTag(key []byte, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,266 @@
+package dpop_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/AxisCommunications/go-dpop"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	nonceKeyA = bytes.Repeat([]byte("a"), dpop.MINIMUM_NONCE_KEY_SIZE)
+	nonceKeyB = bytes.Repeat([]byte("b"), dpop.MINIMUM_NONCE_KEY_SIZE)
+)
+
+// Test that an issued nonce can be verified
+func TestNonceIssuer_IssueAndVerify(t *testing.T) {
+	// Arrange
+	underTest, err := dpop.NewNonceIssuer([][]byte{nonceKeyA}, dpop.NonceOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	nonce, err := underTest.Issue()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = underTest.Verify(nonce)
+
+	// Assert
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// Test that nonces that are malformed, tampered with or issued with an unknown key are rejected
+func TestNonceIssuer_InvalidNonce(t *testing.T) {
+	// Arrange
+	issuer, err := dpop.NewNonceIssuer([][]byte{nonceKeyA}, dpop.NonceOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	underTest, err := dpop.NewNonceIssuer([][]byte{nonceKeyB}, dpop.NonceOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	nonce, err := issuer.Issue()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ownNonce, err := underTest.Issue()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tampered := []byte(ownNonce)
+	if tampered[10] == 'A' {
+		tampered[10] = 'B'
+	} else {
+		tampered[10] = 'A'
+	}
+
+	testCases := map[string]string{
+		"empty":       "",
+		"malformed":   "not a nonce",
+		"unknown key": nonce,
+		"tampered":    string(tampered),
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			err := underTest.Verify(testCase)
+
+			// Assert
+			if !errors.Is(err, dpop.ErrInvalidNonce) {
+				t.Errorf("Unexpected error type: %v", err)
+			}
+		})
+	}
+}
+
+// Test that a nonce is rejected once its lifetime has passed
+func TestNonceIssuer_ExpiredNonce(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	lifetime := time.Minute
+	underTest, err := dpop.NewNonceIssuer([][]byte{nonceKeyA}, dpop.NonceOptions{
+		Lifetime: &lifetime,
+		Now:      func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	nonce, err := underTest.Issue()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	now = now.Add(2 * lifetime)
+	err = underTest.Verify(nonce)
+
+	// Assert
+	if !errors.Is(err, dpop.ErrNonceExpired) {
+		t.Errorf("Unexpected error type: %v", err)
+	}
+}
+
+// Test that nonces issued with a previous key are still accepted
+func TestNonceIssuer_RotatedKey(t *testing.T) {
+	// Arrange
+	previous, err := dpop.NewNonceIssuer([][]byte{nonceKeyA}, dpop.NonceOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	underTest, err := dpop.NewNonceIssuer([][]byte{nonceKeyB, nonceKeyA}, dpop.NonceOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	nonce, err := previous.Issue()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	err = underTest.Verify(nonce)
+
+	// Assert
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// Test that short keys are rejected
+func TestNewNonceIssuer_ShortKey(t *testing.T) {
+	// Act
+	_, err := dpop.NewNonceIssuer([][]byte{[]byte("short")}, dpop.NonceOptions{})
+
+	// Assert
+	if !errors.Is(err, dpop.ErrNonceKeyTooShort) {
+		t.Errorf("Unexpected error type: %v", err)
+	}
+}
+
+// Test that Parse uses the nonce verifier to check the `nonce` claim
+func TestParse_NonceVerifier(t *testing.T) {
+	// Arrange
+	issuer, err := dpop.NewNonceIssuer([][]byte{nonceKeyA}, dpop.NonceOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	nonce, err := issuer.Issue()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	httpUrl := url.URL{Scheme: "https", Host: "server.example.com", Path: "/token"}
+	opts := dpop.ParseOptions{
+		NonceVerifier:     issuer,
+		NonceHasTimestamp: true,
+	}
+
+	for name, testCase := range map[string]struct {
+		nonce string
+		valid bool
+	}{
+		"issued nonce":  {nonce: nonce, valid: true},
+		"missing nonce": {nonce: "", valid: false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			proofString, err := dpop.Create(jwt.SigningMethodES256, &dpop.ProofTokenClaims{
+				RegisteredClaims: &jwt.RegisteredClaims{
+					ID:       "id",
+					IssuedAt: jwt.NewNumericDate(time.Now()),
+				},
+				Method: dpop.POST,
+				URL:    "https://server.example.com/token",
+				Nonce:  testCase.nonce,
+			}, privateKey)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			// Act
+			proof, err := dpop.Parse(proofString, dpop.POST, &httpUrl, opts)
+
+			// Assert
+			if testCase.valid && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if !testCase.valid && !errors.Is(err, dpop.ErrIncorrectNonce) {
+				t.Errorf("Unexpected error type: %v", err)
+			}
+			if testCase.valid && proof == nil {
+				t.Errorf("Expected proof to be parsed")
+			}
+		})
+	}
+}
+
+// A nonce verifier that always fails with the supplied error.
+type failingNonceVerifier struct {
+	err error
+}
+
+func (v failingNonceVerifier) Verify(nonce string) error {
+	return v.err
+}
+
+// Test that only errors for nonces that do not verify are reported as ErrIncorrectNonce
+func TestParse_NonceVerifierError(t *testing.T) {
+	// Arrange
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	proofString, err := dpop.Create(jwt.SigningMethodES256, &dpop.ProofTokenClaims{
+		RegisteredClaims: &jwt.RegisteredClaims{
+			ID:       "id",
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+		Method: dpop.POST,
+		URL:    "https://server.example.com/token",
+		Nonce:  "nonce",
+	}, privateKey)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	httpUrl := url.URL{Scheme: "https", Host: "server.example.com", Path: "/token"}
+	errKeyStore := errors.New("key store unavailable")
+
+	for name, testCase := range map[string]struct {
+		err            error
+		incorrectNonce bool
+	}{
+		"invalid nonce":   {err: dpop.ErrInvalidNonce, incorrectNonce: true},
+		"expired nonce":   {err: dpop.ErrNonceExpired, incorrectNonce: true},
+		"key store error": {err: errKeyStore, incorrectNonce: false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			_, err := dpop.Parse(proofString, dpop.POST, &httpUrl, dpop.ParseOptions{
+				NonceVerifier:     failingNonceVerifier{err: testCase.err},
+				NonceHasTimestamp: true,
+			})
+
+			// Assert
+			if !errors.Is(err, testCase.err) {
+				t.Errorf("Expected error %v, got %v", testCase.err, err)
+			}
+			if errors.Is(err, dpop.ErrIncorrectNonce) != testCase.incorrectNonce {
+				t.Errorf("Unexpected error type: %v", err)
+			}
+		})
+	}
+}
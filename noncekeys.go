@@ -0,0 +1,271 @@
+package dpop
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const DEFAULT_NONCE_KEY_ROTATION_INTERVAL = time.Hour
+const DEFAULT_NONCE_KEY_REFRESH_INTERVAL = time.Minute
+
+// NonceKeys are the keys of a NonceKeyRing at a point in time.
+type NonceKeys struct {
+	// The key used to issue new nonces.
+	Current []byte `json:"current"`
+
+	// The key that was current before the last rotation, nonces issued with it are still accepted.
+	Previous []byte `json:"previous,omitempty"`
+
+	// The time of the last rotation.
+	RotatedAt time.Time `json:"rotated_at"`
+}
+
+// NonceKeyStore persists the keys of a NonceKeyRing, allowing several servers to share them.
+//
+// If the store is shared by several servers, SaveNonceKeys should only succeed if the stored keys
+// have not been rotated by another server since they were loaded. Otherwise nonces issued by the server
+// whose rotation is overwritten will be rejected until they expire.
+type NonceKeyStore interface {
+	// LoadNonceKeys returns the stored keys, or empty NonceKeys if no keys have been stored.
+	LoadNonceKeys(ctx context.Context) (NonceKeys, error)
+
+	// SaveNonceKeys stores rotated keys.
+	SaveNonceKeys(ctx context.Context, keys NonceKeys) error
+}
+
+// NonceKeyRingOptions and its contents are optional for the NewNonceKeyRing function.
+type NonceKeyRingOptions struct {
+	// The time between key rotations. If not set the default is 1 hour.
+	//
+	// As nonces are accepted for one rotation interval after their key has been replaced,
+	// the interval should be at least as long as the nonce lifetime.
+	RotationInterval *time.Duration
+
+	// The time between loading keys from the store, which is how fast rotations by other servers are picked up.
+	// If not set the default is 1 minute.
+	RefreshInterval *time.Duration
+
+	// Where keys are stored. If not set keys are only kept in memory and can not be shared with other servers.
+	Store NonceKeyStore
+
+	// If set the key ring never rotates keys and only uses the keys loaded from the store.
+	// This allows a single server to rotate keys that are shared by the other servers.
+	ReadOnly bool
+
+	// Used to get the current time. If not set time.Now is used.
+	Now func() time.Time
+}
+
+// NonceKeyRing is a NonceKeySource that holds a current and a previous key and rotates them on a timer.
+//
+// Rotation happens when keys are requested after the rotation interval has passed,
+// so no background routine is needed.
+// Keys are loaded from and saved to the store without blocking callers that can use the cached keys,
+// and the cached keys are kept if loading fails. Keys are never loaded and rotated at the same time.
+// It is safe for concurrent use.
+type NonceKeyRing struct {
+	mu       sync.Mutex
+	keys     NonceKeys
+	loadedAt time.Time
+	updating chan struct{} // Closed when an ongoing load from or save to the store has finished.
+	rotation time.Duration
+	refresh  time.Duration
+	store    NonceKeyStore
+	readOnly bool
+	now      func() time.Time
+}
+
+// NewNonceKeyRing creates a NonceKeyRing.
+// Keys are loaded from the store, or generated, the first time they are requested.
+func NewNonceKeyRing(opts NonceKeyRingOptions) *NonceKeyRing {
+	rotation := DEFAULT_NONCE_KEY_ROTATION_INTERVAL
+	if opts.RotationInterval != nil {
+		rotation = *opts.RotationInterval
+	}
+	refresh := DEFAULT_NONCE_KEY_REFRESH_INTERVAL
+	if opts.RefreshInterval != nil {
+		refresh = *opts.RefreshInterval
+	}
+	now := time.Now
+	if opts.Now != nil {
+		now = opts.Now
+	}
+
+	return &NonceKeyRing{
+		rotation: rotation,
+		refresh:  refresh,
+		store:    opts.Store,
+		readOnly: opts.ReadOnly && opts.Store != nil,
+		now:      now,
+	}
+}
+
+// Implement the NonceKeySource interface.
+//
+// The keys are refreshed from the store and rotated if needed before they are returned.
+// While another caller loads or saves keys the cached keys are returned.
+func (r *NonceKeyRing) NonceKeys() ([][]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.updating == nil || r.keys.Current == nil {
+		r.wait()
+		now := r.now()
+		if r.store != nil && (r.loadedAt.IsZero() || now.Sub(r.loadedAt) >= r.refresh) {
+			// Keep using the cached keys if they could not be refreshed.
+			if err := r.load(now); err != nil && r.keys.Current == nil {
+				return nil, err
+			}
+		}
+		if !r.readOnly && (r.keys.Current == nil || now.Sub(r.keys.RotatedAt) >= r.rotation) {
+			if err := r.rotate(now); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if r.keys.Current == nil {
+		return nil, ErrMissingNonceKey
+	}
+
+	keys := [][]byte{r.keys.Current}
+	if r.keys.Previous != nil {
+		keys = append(keys, r.keys.Previous)
+	}
+	return keys, nil
+}
+
+// Rotate replaces the current key with a new random key and keeps the current key as the previous key.
+func (r *NonceKeyRing) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.wait()
+	return r.rotate(r.now())
+}
+
+// Loads the keys from the store. The lock must be held.
+func (r *NonceKeyRing) load(now time.Time) error {
+	var keys NonceKeys
+	var err error
+	r.unlocked(func() {
+		keys, err = r.store.LoadNonceKeys(context.Background())
+	})
+	if err != nil {
+		// Wait a refresh interval before retrying, unless there are no keys to use meanwhile.
+		if r.keys.Current != nil {
+			r.loadedAt = now
+		}
+		return err
+	}
+	r.keys = keys
+	r.loadedAt = now
+	return nil
+}
+
+// Rotates the keys and saves them to the store. The lock must be held.
+func (r *NonceKeyRing) rotate(now time.Time) error {
+	key := make([]byte, MINIMUM_NONCE_KEY_SIZE)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+
+	rotated := NonceKeys{
+		Current:   key,
+		Previous:  r.keys.Current,
+		RotatedAt: now,
+	}
+	if r.store != nil {
+		var err error
+		r.unlocked(func() {
+			err = r.store.SaveNonceKeys(context.Background(), rotated)
+		})
+		if err != nil {
+			return err
+		}
+		r.loadedAt = now
+	}
+	r.keys = rotated
+	return nil
+}
+
+// Runs a load from or save to the store without holding the lock, which is held again when it returns.
+// Other callers use the cached keys meanwhile, or wait for it to finish.
+func (r *NonceKeyRing) unlocked(f func()) {
+	updating := make(chan struct{})
+	r.updating = updating
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		r.updating = nil
+		close(updating)
+	}()
+	f()
+}
+
+// Waits until no keys are loaded or saved. The lock must be held, it is released while waiting.
+func (r *NonceKeyRing) wait() {
+	for r.updating != nil {
+		updating := r.updating
+		r.mu.Unlock()
+		<-updating
+		r.mu.Lock()
+	}
+}
+
+// FileNonceKeyStore is a NonceKeyStore that keeps keys in a JSON file, for example on a shared volume.
+//
+// It does not detect concurrent rotations, so when sharing the file between servers
+// only one of them should rotate keys while the others use a read-only NonceKeyRing.
+type FileNonceKeyStore struct {
+	// The path of the file, it is created on the first save.
+	Path string
+}
+
+// Implement the NonceKeyStore interface.
+func (s FileNonceKeyStore) LoadNonceKeys(ctx context.Context) (NonceKeys, error) {
+	b, err := os.ReadFile(s.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return NonceKeys{}, nil
+	}
+	if err != nil {
+		return NonceKeys{}, err
+	}
+
+	keys := NonceKeys{}
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return NonceKeys{}, err
+	}
+	return keys, nil
+}
+
+// Implement the NonceKeyStore interface.
+//
+// The file is replaced atomically so that readers never see a partially written file.
+func (s FileNonceKeyStore) SaveNonceKeys(ctx context.Context, keys NonceKeys) error {
+	b, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.Path)
+}
@@ -0,0 +1,250 @@
+package dpop_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AxisCommunications/go-dpop"
+)
+
+// Test that nonces stay valid for one rotation after their key has been replaced
+func TestNonceKeyRing_Rotation(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	rotation := time.Hour
+	lifetime := 3 * time.Hour
+	ring := dpop.NewNonceKeyRing(dpop.NonceKeyRingOptions{
+		RotationInterval: &rotation,
+		Now:              func() time.Time { return now },
+	})
+	underTest := dpop.NewNonceIssuerWithKeySource(ring, dpop.NonceOptions{
+		Lifetime: &lifetime,
+		Now:      func() time.Time { return now },
+	})
+	nonce, err := underTest.Issue()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	now = now.Add(rotation)
+	afterOneRotation := underTest.Verify(nonce)
+	now = now.Add(rotation)
+	afterTwoRotations := underTest.Verify(nonce)
+
+	// Assert
+	if afterOneRotation != nil {
+		t.Errorf("Unexpected error: %v", afterOneRotation)
+	}
+	if !errors.Is(afterTwoRotations, dpop.ErrInvalidNonce) {
+		t.Errorf("Unexpected error type: %v", afterTwoRotations)
+	}
+}
+
+// Test that servers sharing a key file can verify each others nonces
+func TestNonceKeyRing_SharedFileStore(t *testing.T) {
+	// Arrange
+	store := dpop.FileNonceKeyStore{Path: filepath.Join(t.TempDir(), "nonce-keys.json")}
+	now := time.Now()
+	clock := func() time.Time { return now }
+	refresh := time.Minute
+	rotating := dpop.NewNonceIssuerWithKeySource(dpop.NewNonceKeyRing(dpop.NonceKeyRingOptions{
+		Store:           store,
+		RefreshInterval: &refresh,
+		Now:             clock,
+	}), dpop.NonceOptions{Now: clock})
+	readOnly := dpop.NewNonceIssuerWithKeySource(dpop.NewNonceKeyRing(dpop.NonceKeyRingOptions{
+		Store:           store,
+		RefreshInterval: &refresh,
+		ReadOnly:        true,
+		Now:             clock,
+	}), dpop.NonceOptions{Now: clock})
+
+	// Act
+	nonce, err := rotating.Issue()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = readOnly.Verify(nonce)
+
+	// Assert
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// Test that a read-only key ring without stored keys can not issue nonces
+func TestNonceKeyRing_ReadOnlyWithoutKeys(t *testing.T) {
+	// Arrange
+	store := dpop.FileNonceKeyStore{Path: filepath.Join(t.TempDir(), "nonce-keys.json")}
+	underTest := dpop.NewNonceIssuerWithKeySource(dpop.NewNonceKeyRing(dpop.NonceKeyRingOptions{
+		Store:    store,
+		ReadOnly: true,
+	}), dpop.NonceOptions{})
+
+	// Act
+	_, err := underTest.Issue()
+
+	// Assert
+	if !errors.Is(err, dpop.ErrMissingNonceKey) {
+		t.Errorf("Unexpected error type: %v", err)
+	}
+}
+
+// A key store whose loads can be made to fail or block.
+type testNonceKeyStore struct {
+	keys    dpop.NonceKeys
+	err     error
+	started chan struct{}
+	blocked chan struct{}
+	loads   int
+}
+
+func (s *testNonceKeyStore) LoadNonceKeys(ctx context.Context) (dpop.NonceKeys, error) {
+	s.loads++
+	keys := s.keys
+	if blocked := s.blocked; blocked != nil {
+		s.blocked = nil
+		close(s.started)
+		<-blocked
+	}
+	return keys, s.err
+}
+
+func (s *testNonceKeyStore) SaveNonceKeys(ctx context.Context, keys dpop.NonceKeys) error {
+	s.keys = keys
+	return nil
+}
+
+// Test that the cached keys are used, without retrying the store on every request, when loading fails
+func TestNonceKeyRing_LoadFailure(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	refresh := time.Minute
+	store := &testNonceKeyStore{}
+	underTest := dpop.NewNonceKeyRing(dpop.NonceKeyRingOptions{
+		Store:           store,
+		RefreshInterval: &refresh,
+		Now:             func() time.Time { return now },
+	})
+	cached, err := underTest.NonceKeys()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	store.err = errors.New("store unavailable")
+	now = now.Add(refresh)
+
+	// Act
+	first, firstErr := underTest.NonceKeys()
+	second, secondErr := underTest.NonceKeys()
+
+	// Assert
+	if firstErr != nil || secondErr != nil {
+		t.Errorf("Unexpected errors: %v, %v", firstErr, secondErr)
+	}
+	if string(first[0]) != string(cached[0]) || string(second[0]) != string(cached[0]) {
+		t.Errorf("Expected the cached keys")
+	}
+	if store.loads != 2 {
+		t.Errorf("Expected 2 loads, got %d", store.loads)
+	}
+}
+
+// Test that keys are not returned when the first load fails
+func TestNonceKeyRing_FirstLoadFailure(t *testing.T) {
+	// Arrange
+	storeErr := errors.New("store unavailable")
+	underTest := dpop.NewNonceKeyRing(dpop.NonceKeyRingOptions{
+		Store: &testNonceKeyStore{err: storeErr},
+	})
+
+	// Act
+	_, err := underTest.NonceKeys()
+
+	// Assert
+	if !errors.Is(err, storeErr) {
+		t.Errorf("Unexpected error type: %v", err)
+	}
+}
+
+// Test that the cached keys are used while the store is loading
+func TestNonceKeyRing_SlowLoad(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	refresh := time.Minute
+	store := &testNonceKeyStore{}
+	underTest := dpop.NewNonceKeyRing(dpop.NonceKeyRingOptions{
+		Store:           store,
+		RefreshInterval: &refresh,
+		Now:             func() time.Time { return now },
+	})
+	if _, err := underTest.NonceKeys(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	store.started = make(chan struct{})
+	store.blocked = make(chan struct{})
+	blocked := store.blocked
+	now = now.Add(refresh)
+	loading := make(chan struct{})
+	go func() {
+		defer close(loading)
+		_, _ = underTest.NonceKeys()
+	}()
+	<-store.started
+
+	// Act
+	keys, err := underTest.NonceKeys()
+
+	// Assert
+	if err != nil || len(keys) == 0 {
+		t.Errorf("Expected the cached keys, got %v", err)
+	}
+	close(blocked)
+	<-loading
+}
+
+// Test that keys are not rotated while they are loaded, so that a slow load does not replace rotated keys
+func TestNonceKeyRing_RotationDuringLoad(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	clock := func() time.Time { return now }
+	rotation := time.Hour
+	store := &testNonceKeyStore{}
+	ring := dpop.NewNonceKeyRing(dpop.NonceKeyRingOptions{
+		Store:            store,
+		RotationInterval: &rotation,
+		Now:              clock,
+	})
+	underTest := dpop.NewNonceIssuerWithKeySource(ring, dpop.NonceOptions{Now: clock})
+	if _, err := ring.NonceKeys(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	store.started = make(chan struct{})
+	store.blocked = make(chan struct{})
+	blocked := store.blocked
+	now = now.Add(rotation)
+	loading := make(chan struct{})
+	go func() {
+		defer close(loading)
+		_, _ = ring.NonceKeys()
+	}()
+	<-store.started
+
+	// Act
+	nonce, err := underTest.Issue()
+	close(blocked)
+	<-loading
+	verifyErr := underTest.Verify(nonce)
+	rotatedErr := underTest.Verify(nonce)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if verifyErr != nil || rotatedErr != nil {
+		t.Errorf("Expected the nonce issued during the load to be valid, got %v and %v", verifyErr, rotatedErr)
+	}
+}
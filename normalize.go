@@ -0,0 +1,150 @@
+package dpop
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Default ports that are removed during normalization.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// NormalizeHTU normalizes a URL according to https://datatracker.ietf.org/doc/html/rfc3986#section-6
+// so that it can be compared to the `htu` claim of a proof.
+// This is suggested by point 9 in https://datatracker.ietf.org/doc/html/rfc9449#section-4.3
+//
+// The scheme and host are lowercased, default ports are removed, percent-encodings are uppercased
+// and unreserved characters are decoded, dot segments are removed and an empty path is replaced with "/".
+// Any userinfo, the query and the fragment are stripped as they are not part of the `htu` claim.
+//
+// Clients can use this function to create the `htu` claim of a proof.
+func NormalizeHTU(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", ErrInvalidHTU
+	}
+	return normalizeURL(u), nil
+}
+
+// Normalizes a parsed URL without modifying it.
+func normalizeURL(u *url.URL) string {
+	scheme, host := normalizeOrigin(u)
+
+	path := removeDotSegments(normalizePercentEncoding(u.EscapedPath()))
+	if path == "" {
+		path = "/"
+	}
+
+	var b strings.Builder
+	b.WriteString(scheme)
+	b.WriteString("://")
+	b.WriteString(host)
+	b.WriteString(path)
+	return b.String()
+}
+
+// Returns the lowercased scheme and host of a URL, with any default port removed.
+func normalizeOrigin(u *url.URL) (scheme string, host string) {
+	scheme = strings.ToLower(u.Scheme)
+
+	host = strings.ToLower(u.Host)
+	if hostname, port, err := net.SplitHostPort(host); err == nil {
+		if port == "" || port == defaultPorts[scheme] {
+			host = hostname
+			// Keep brackets of IPv6 hosts.
+			if strings.Contains(hostname, ":") {
+				host = "[" + hostname + "]"
+			}
+		}
+	}
+	return scheme, host
+}
+
+// Uppercases the hexadecimal digits of percent-encodings and decodes percent-encoded unreserved characters.
+// See https://datatracker.ietf.org/doc/html/rfc3986#section-6.2.2.1 and https://datatracker.ietf.org/doc/html/rfc3986#section-6.2.2.2
+func normalizePercentEncoding(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		c := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteString(strings.ToUpper(s[i+1 : i+3]))
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+// Removes "." and ".." segments from a path.
+// See https://datatracker.ietf.org/doc/html/rfc3986#section-5.2.4
+func removeDotSegments(input string) string {
+	var output []string
+	for input != "" {
+		switch {
+		case strings.HasPrefix(input, "../"):
+			input = input[3:]
+		case strings.HasPrefix(input, "./"):
+			input = input[2:]
+		case strings.HasPrefix(input, "/./"):
+			input = input[2:]
+		case input == "/.":
+			input = "/"
+		case strings.HasPrefix(input, "/../"):
+			input = input[3:]
+			if len(output) > 0 {
+				output = output[:len(output)-1]
+			}
+		case input == "/..":
+			input = "/"
+			if len(output) > 0 {
+				output = output[:len(output)-1]
+			}
+		case input == "." || input == "..":
+			input = ""
+		default:
+			// Move the first segment, including any initial "/", to the output.
+			end := strings.IndexByte(input[1:], '/')
+			if end == -1 {
+				end = len(input)
+			} else {
+				end++
+			}
+			output = append(output, input[:end])
+			input = input[end:]
+		}
+	}
+	return strings.Join(output, "")
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
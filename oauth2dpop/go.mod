@@ -0,0 +1,11 @@
+module github.com/AxisCommunications/go-dpop/oauth2dpop
+
+go 1.20
+
+require (
+	github.com/AxisCommunications/go-dpop v0.0.0-00010101000000-000000000000
+	github.com/golang-jwt/jwt/v5 v5.2.1
+	golang.org/x/oauth2 v0.26.0
+)
+
+replace github.com/AxisCommunications/go-dpop => ../
@@ -0,0 +1,118 @@
+// Package oauth2dpop adds DPoP support to golang.org/x/oauth2.
+//
+// Token requests are sent with DPoP proofs so that the authorization server binds the issued tokens to the key of the client,
+// and requests to resource servers are sent with the bound access token in a `DPoP` authorization header together with a proof.
+// See https://datatracker.ietf.org/doc/html/rfc9449
+package oauth2dpop
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/AxisCommunications/go-dpop"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// The authorization server issued a token that is not bound to the key of the client.
+var ErrNotBoundToken = errors.New("token is not a DPoP bound token")
+
+// Config is an oauth2.Config that sends DPoP proofs with every token request.
+//
+// All proofs are signed with the same key so that refresh tokens bound to the key can be used.
+type Config struct {
+	*oauth2.Config
+
+	transport *dpop.Transport
+}
+
+// Options and its contents are optional for the NewConfig function.
+type Options struct {
+	// The method used to sign proofs. If not set it is chosen from the type of the key.
+	SigningMethod jwt.SigningMethod
+
+	// The transport used to send requests. If not set http.DefaultTransport is used.
+	Base http.RoundTripper
+}
+
+// NewConfig creates a Config that signs proofs with the supplied key.
+func NewConfig(config *oauth2.Config, key crypto.Signer, opts Options) *Config {
+	return &Config{
+		Config: config,
+		transport: &dpop.Transport{
+			Key:           key,
+			SigningMethod: opts.SigningMethod,
+			Base:          opts.Base,
+		},
+	}
+}
+
+// Exchange converts an authorization code into a DPoP bound token, see oauth2.Config.Exchange.
+//
+// An error is returned if the authorization server does not issue a token with the `DPoP` token type.
+func (c *Config) Exchange(ctx context.Context, code string, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	token, err := c.Config.Exchange(c.context(ctx), code, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return checkTokenType(token)
+}
+
+// PasswordCredentialsToken converts a resource owner username and password into a DPoP bound token,
+// see oauth2.Config.PasswordCredentialsToken.
+func (c *Config) PasswordCredentialsToken(ctx context.Context, username, password string) (*oauth2.Token, error) {
+	token, err := c.Config.PasswordCredentialsToken(c.context(ctx), username, password)
+	if err != nil {
+		return nil, err
+	}
+	return checkTokenType(token)
+}
+
+// TokenSource returns a TokenSource that refreshes the token with proofs signed by the key of the Config.
+func (c *Config) TokenSource(ctx context.Context, token *oauth2.Token) oauth2.TokenSource {
+	return &tokenSource{source: c.Config.TokenSource(c.context(ctx), token)}
+}
+
+// Client returns a HTTP client that sends the DPoP bound access token and a proof with every request,
+// refreshing the token as needed.
+func (c *Config) Client(ctx context.Context, token *oauth2.Token) *http.Client {
+	return &http.Client{
+		Transport: &oauth2.Transport{
+			Source: c.TokenSource(ctx, token),
+			Base:   c.transport,
+		},
+	}
+}
+
+// Returns a context that makes the oauth2 package use the DPoP transport for token requests.
+func (c *Config) context(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: c.transport})
+}
+
+type tokenSource struct {
+	source oauth2.TokenSource
+}
+
+func (s *tokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.source.Token()
+	if err != nil {
+		return nil, err
+	}
+	return checkTokenType(token)
+}
+
+// Checks that the token is DPoP bound, the token type is case insensitive.
+// See https://datatracker.ietf.org/doc/html/rfc6749#section-5.1
+func checkTokenType(token *oauth2.Token) (*oauth2.Token, error) {
+	if !strings.EqualFold(token.TokenType, dpop.TokenTypeDPoP) {
+		return nil, ErrNotBoundToken
+	}
+	// Make sure that the access token is sent with the `DPoP` authorization scheme
+	// without modifying a token that may be shared by a reusable token source.
+	bound := *token
+	bound.TokenType = dpop.TokenTypeDPoP
+	return &bound, nil
+}
@@ -0,0 +1,140 @@
+package oauth2dpop_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AxisCommunications/go-dpop"
+	"github.com/AxisCommunications/go-dpop/oauth2dpop"
+	"golang.org/x/oauth2"
+)
+
+// Test server that issues DPoP bound tokens and protects a resource with them.
+type testServer struct {
+	*httptest.Server
+	tokenType string
+	jkt       map[string]string
+}
+
+func newTestServer(t *testing.T, tokenType string) *testServer {
+	s := &testServer{tokenType: tokenType, jkt: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		proof, err := dpop.ParseRequest(r, dpop.ParseOptions{})
+		if err != nil {
+			dpop.WriteError(w, err, dpop.ErrorResponseOptions{TokenEndpoint: true})
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+
+		// A refresh token can only be used with the key it is bound to.
+		if r.PostForm.Get("grant_type") == "refresh_token" {
+			if s.jkt[r.PostForm.Get("refresh_token")] != proof.PublicKey() {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+				return
+			}
+		}
+
+		accessToken, refreshToken := randomString(t), randomString(t)
+		s.jkt[accessToken] = proof.PublicKey()
+		s.jkt[refreshToken] = proof.PublicKey()
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  accessToken,
+			"token_type":    s.tokenType,
+			"refresh_token": refreshToken,
+			"expires_in":    3600,
+		})
+	})
+	mux.Handle("/resource", dpop.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}), dpop.MiddlewareOptions{
+		ParseAccessToken: func(r *http.Request, accessToken string) (dpop.BoundClaims, error) {
+			jkt, ok := s.jkt[accessToken]
+			if !ok {
+				return nil, errors.New("unknown token")
+			}
+			return &dpop.BoundAccessTokenClaims{
+				Confirmation: dpop.Confirmation{JWKThumbprint: jkt},
+			}, nil
+		},
+	}))
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func randomString(t *testing.T) string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func newTestConfig(t *testing.T, server *testServer) *oauth2dpop.Config {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return oauth2dpop.NewConfig(&oauth2.Config{
+		ClientID: "client",
+		Endpoint: oauth2.Endpoint{
+			TokenURL:  server.URL + "/token",
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}, privateKey, oauth2dpop.Options{})
+}
+
+// Test that a bound token can be used to access a resource and be refreshed
+func TestConfig(t *testing.T) {
+	// Arrange
+	server := newTestServer(t, "DPoP")
+	underTest := newTestConfig(t, server)
+
+	// Act
+	token, err := underTest.Exchange(context.Background(), "code")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Force the token to be refreshed before it is used
+	token.Expiry = time.Now().Add(-time.Hour)
+	client := underTest.Client(context.Background(), token)
+	res, err := client.Get(server.URL + "/resource")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected resource to be accessed, got %d: %s", res.StatusCode, res.Header.Get("WWW-Authenticate"))
+	}
+}
+
+// Test that a token that is not bound is rejected
+func TestConfig_BearerToken(t *testing.T) {
+	// Arrange
+	server := newTestServer(t, "Bearer")
+	underTest := newTestConfig(t, server)
+
+	// Act
+	_, err := underTest.Exchange(context.Background(), "code")
+
+	// Assert
+	if !errors.Is(err, oauth2dpop.ErrNotBoundToken) {
+		t.Errorf("Unexpected error type: %v", err)
+	}
+}
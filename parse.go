@@ -1,15 +1,15 @@
 package dpop
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rsa"
-	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
-	"math/big"
 	"net/url"
 	"strings"
 	"time"
@@ -36,14 +36,28 @@ const (
 
 const DEFAULT_ALLOWED_PROOF_AGE = time.Minute * 5
 const DEFAULT_ALLOWED_TIME_WINDOW = time.Second * 0
+const DEFAULT_MINIMUM_RSA_KEY_SIZE = 2048
+
+// DefaultAllowedAlgorithms returns the signing algorithms accepted by Parse if ParseOptions.AllowedAlgorithms is not set.
+//
+// RS384, RS512, PS384 and PS512 are also supported but have to be allowed explicitly with ParseOptions.AllowedAlgorithms.
+func DefaultAllowedAlgorithms() []string {
+	return []string{"ES256", "ES384", "ES512", "RS256", "PS256", "EdDSA"}
+}
 
 // ParseOptions and its contents are optional for the Parse function.
 type ParseOptions struct {
 	// The expected nonce if the authorization server has issued a nonce.
 	Nonce string
 
+	// Used to verify the nonce if the server issues its own nonces, for example with a NonceIssuer.
+	// If set a proof with a nonce that does not verify is rejected.
+	NonceVerifier NonceVerifier
+
 	// Used to control if the `iat` field is within allowed clock-skew.
 	// If set to true the authorization server has to validate the nonce timestamp itself.
+	// Unless NonceVerifier is an ExpiringNonceVerifier, AllowedProofAge must then be at least the nonce lifetime
+	// as it is how long the `jti` of an accepted proof is kept in the ReplayCache.
 	NonceHasTimestamp bool
 
 	// The allowed clock-skew (into the future) on the `iat` of the proof. If not set proof is rejected if issued in the future.
@@ -55,6 +69,22 @@ type ParseOptions struct {
 	// dpop_jkt parameter that is optionally sent by the client to the authorization server on token request.
 	// If set the proof proof-of-possession public key needs to match or the proof is rejected.
 	JKT string
+
+	// The `alg` values a proof may be signed with. If not set DefaultAllowedAlgorithms is used.
+	// This list can be advertised as `dpop_signing_alg_values_supported`.
+	AllowedAlgorithms []string
+
+	// The minimum size in bits of the modulus of a RSA proof key. If not set the default is 2048 bits.
+	MinimumRSAKeySize int
+
+	// Forwarded headers that are trusted by ParseRequest when determining the scheme and host of the request.
+	// Supported headers are "Forwarded", "X-Forwarded-Proto" and "X-Forwarded-Host".
+	// Only set this if the server is behind a proxy that sets or appends to these headers. The last element of each header is used.
+	TrustedForwardedHeaders []string
+
+	// Used to track the `jti` of accepted proofs. If set a proof that has already been accepted is rejected.
+	// Entries are kept until the proof would be rejected for being too old, or its nonce would expire if NonceHasTimestamp is set.
+	ReplayCache ReplayCache
 }
 
 // Parse translates a DPoP proof string into a JWT token and parses it with the jwt package (github.com/golang-jwt/jwt/v5).
@@ -62,6 +92,8 @@ type ParseOptions struct {
 // but not check whether the proof matches a bound access token. It also assumes point 1 is checked by the calling application.
 //
 // Protected resources should use the 'Validate' function on the returned proof to ensure that the proof matches any bound access token.
+//
+// The supplied URL is not modified.
 func Parse(
 	tokenString string,
 	httpMethod HTTPVerb,
@@ -73,7 +105,7 @@ func Parse(
 	// that it contains a public key, and that the signature verifies with the public key.
 	// This satisfies point 2, 5, 6 and 7 in https://datatracker.ietf.org/doc/html/rfc9449#section-4.3
 	claims := ProofTokenClaims{RegisteredClaims: &jwt.RegisteredClaims{}}
-	dpopToken, err := jwt.ParseWithClaims(tokenString, &claims, keyFunc)
+	dpopToken, err := jwt.ParseWithClaims(tokenString, &claims, keyFunc(opts))
 	if err != nil {
 		return nil, errors.Join(ErrInvalidProof, err)
 	}
@@ -91,21 +123,31 @@ func Parse(
 		return nil, errors.Join(ErrInvalidProof, ErrUnsupportedJWTType)
 	}
 
-	// Strip the incoming URI of query and fragment according to point 9 in https://datatracker.ietf.org/doc/html/rfc9449#section-4.3
-	httpURL.RawQuery = ""
-	httpURL.Fragment = ""
-
 	// Check that `htm` and `htu` claims match the HTTP method and URL of the current request.
+	// Both URLs are normalized before comparison to avoid rejecting equivalent URLs.
+	// The normalization strips the incoming URI of query and fragment without modifying it.
 	// This satisfies point 8 and 9 in https://datatracker.ietf.org/doc/html/rfc9449#section-4.3
-	if httpMethod != claims.Method || httpURL.String() != claims.URL {
+	htu, err := NormalizeHTU(claims.URL)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidProof, ErrIncorrectHTTPTarget, err)
+	}
+	if httpMethod != claims.Method || normalizeURL(httpURL) != htu {
 		return nil, errors.Join(ErrInvalidProof, ErrIncorrectHTTPTarget)
 	}
 
 	// Check that `nonce` is correct
 	// This satisfies point 10 in https://datatracker.ietf.org/doc/html/rfc9449#section-4.3
-	if opts.Nonce != "" && opts.Nonce != claims.Nonce {
+	if opts.Nonce != "" && !constantTimeEqual(opts.Nonce, claims.Nonce) {
 		return nil, ErrIncorrectNonce
 	}
+	if opts.NonceVerifier != nil {
+		if err := opts.NonceVerifier.Verify(claims.Nonce); err != nil {
+			if errors.Is(err, ErrInvalidNonce) || errors.Is(err, ErrNonceExpired) {
+				return nil, errors.Join(ErrIncorrectNonce, err)
+			}
+			return nil, err
+		}
+	}
 
 	// Check that `iat` is within the acceptable window unless `nonce` contains a server managed timestamp.
 	// This satisfies point 11 in https://datatracker.ietf.org/doc/html/rfc9449#section-4.3
@@ -135,149 +177,168 @@ func Parse(
 	jwk, ok := dpopToken.Header["jwk"].(map[string]interface{})
 	if !ok {
 		// keyFunc used with parseWithClaims should ensure that this can not happen but better safe than sorry.
-		return nil, ErrMissingJWK
+		return nil, errors.Join(ErrInvalidProof, ErrMissingJWK)
 	}
-	jwkJSONbytes, err := getThumbprintableJwkJSONbytes(jwk)
+	parsedJwk, err := jwkFromHeader(jwk)
 	if err != nil {
 		// keyFunc used with parseWithClaims should ensure that this can not happen but better safe than sorry.
 		return nil, errors.Join(ErrInvalidProof, err)
 	}
-	h := sha256.New()
-	_, err = h.Write(jwkJSONbytes)
+	b64URLjwkHash, err := parsedJwk.Thumbprint(crypto.SHA256)
 	if err != nil {
+		// keyFunc used with parseWithClaims should ensure that this can not happen but better safe than sorry.
 		return nil, errors.Join(ErrInvalidProof, err)
 	}
-	b64URLjwkHash := base64.RawURLEncoding.EncodeToString(h.Sum(nil))
 
 	// Check that `dpop_jkt` is correct if supplied to the authorization server on token request.
 	// This satisfies https://datatracker.ietf.org/doc/html/rfc9449#name-authorization-code-binding-
 	if opts.JKT != "" {
-		if b64URLjwkHash != opts.JKT {
+		if !constantTimeEqual(b64URLjwkHash, opts.JKT) {
 			return nil, errors.Join(ErrInvalidProof, ErrIncorrectJKT)
 		}
 	}
 
+	// Check that the proof has not been used before.
+	// This satisfies https://datatracker.ietf.org/doc/html/rfc9449#section-11.1
+	if opts.ReplayCache != nil {
+		past := DEFAULT_ALLOWED_PROOF_AGE
+		if opts.AllowedProofAge != nil {
+			past = *opts.AllowedProofAge
+		}
+		expiry := claims.IssuedAt.Add(past)
+		if opts.NonceHasTimestamp {
+			// The proof is accepted for as long as its nonce verifies, which is at most the nonce lifetime from now.
+			if verifier, ok := opts.NonceVerifier.(ExpiringNonceVerifier); ok && verifier.Lifetime() > past {
+				past = verifier.Lifetime()
+			}
+			expiry = time.Now().Add(past)
+		}
+		if opts.ReplayCache.Seen(b64URLjwkHash, claims.ID, expiry) {
+			return nil, errors.Join(ErrInvalidProof, ErrReplayed)
+		}
+	}
+
 	return &Proof{
 		Token:           dpopToken,
 		HashedPublicKey: b64URLjwkHash,
 	}, nil
 }
 
-func keyFunc(t *jwt.Token) (interface{}, error) {
-	// Return the required jwkHeader header. See https://datatracker.ietf.org/doc/html/rfc9449#section-4.2
-	// Used to validate the signature of the DPoP proof.
-	jwkHeader := t.Header["jwk"]
-	if jwkHeader == nil {
-		return nil, ErrMissingJWK
+func keyFunc(opts ParseOptions) jwt.Keyfunc {
+	allowedAlgorithms := opts.AllowedAlgorithms
+	if allowedAlgorithms == nil {
+		allowedAlgorithms = DefaultAllowedAlgorithms()
 	}
-
-	jwkMap, ok := jwkHeader.(map[string]interface{})
-	if !ok {
-		return nil, ErrMissingJWK
+	minimumRSAKeySize := DEFAULT_MINIMUM_RSA_KEY_SIZE
+	if opts.MinimumRSAKeySize > 0 {
+		minimumRSAKeySize = opts.MinimumRSAKeySize
 	}
 
-	return parseJwk(jwkMap)
-}
-
-// Parses a JWK and inherently strips it of optional fields
-func parseJwk(jwkMap map[string]interface{}) (interface{}, error) {
-	// Ensure that JWK kty is present and is a string.
-	kty, ok := jwkMap["kty"].(string)
-	if !ok {
-		return nil, ErrInvalidProof
-	}
-	switch kty {
-	case "EC":
-		// Ensure that the required fields are present and are strings.
-		x, ok := jwkMap["x"].(string)
-		if !ok {
-			return nil, ErrInvalidProof
+	return func(t *jwt.Token) (interface{}, error) {
+		// Return the required jwkHeader header. See https://datatracker.ietf.org/doc/html/rfc9449#section-4.2
+		// Used to validate the signature of the DPoP proof.
+		jwkHeader := t.Header["jwk"]
+		if jwkHeader == nil {
+			return nil, ErrMissingJWK
 		}
-		y, ok := jwkMap["y"].(string)
-		if !ok {
-			return nil, ErrInvalidProof
-		}
-		crv, ok := jwkMap["crv"].(string)
+
+		jwkMap, ok := jwkHeader.(map[string]interface{})
 		if !ok {
-			return nil, ErrInvalidProof
+			return nil, ErrMissingJWK
 		}
 
-		// Decode the coordinates from Base64.
-		//
-		// According to RFC 7518, they are Base64 URL unsigned integers.
-		// https://tools.ietf.org/html/rfc7518#section-6.3
-		xCoordinate, err := base64urlTrailingPadding(x)
-		if err != nil {
-			return nil, err
-		}
-		yCoordinate, err := base64urlTrailingPadding(y)
+		key, err := parseJwk(jwkMap)
 		if err != nil {
 			return nil, err
 		}
 
-		// Read the specified curve of the key.
-		var curve elliptic.Curve
-		switch crv {
-		case "P-256":
-			curve = elliptic.P256()
-		case "P-384":
-			curve = elliptic.P384()
-		case "P-521":
-			curve = elliptic.P521()
-		default:
-			return nil, ErrUnsupportedCurve
+		// Check that the `alg` header is allowed and can be used with the key.
+		alg := t.Method.Alg()
+		allowed := false
+		for _, a := range allowedAlgorithms {
+			if a == alg {
+				allowed = true
+				break
+			}
 		}
-
-		return &ecdsa.PublicKey{
-			X:     big.NewInt(0).SetBytes(xCoordinate),
-			Y:     big.NewInt(0).SetBytes(yCoordinate),
-			Curve: curve,
-		}, nil
-	case "RSA":
-		// Ensure that the required fields are present and are strings.
-		e, ok := jwkMap["e"].(string)
-		if !ok {
-			return nil, ErrInvalidProof
+		if !allowed {
+			return nil, ErrUnsupportedAlgorithm
 		}
-		n, ok := jwkMap["n"].(string)
-		if !ok {
-			return nil, ErrInvalidProof
+		if !algorithmMatchesKey(alg, key) {
+			return nil, ErrAlgorithmMismatch
 		}
 
-		// Decode the exponent and modulus from Base64.
-		//
-		// According to RFC 7518, they are Base64 URL unsigned integers.
-		// https://tools.ietf.org/html/rfc7518#section-6.3
-		exponent, err := base64urlTrailingPadding(e)
-		if err != nil {
-			return nil, err
+		// Check that a RSA key is large enough.
+		if rsaKey, ok := key.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < minimumRSAKeySize {
+			return nil, ErrRSAKeyTooSmall
 		}
-		modulus, err := base64urlTrailingPadding(n)
-		if err != nil {
-			return nil, err
+
+		return key, nil
+	}
+}
+
+// Checks that the signing algorithm is defined for the key type and curve.
+// See https://datatracker.ietf.org/doc/html/rfc7518#section-3.1
+func algorithmMatchesKey(alg string, key interface{}) bool {
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return alg == "ES256"
+		case elliptic.P384():
+			return alg == "ES384"
+		case elliptic.P521():
+			return alg == "ES512"
 		}
-		return &rsa.PublicKey{
-			N: big.NewInt(0).SetBytes(modulus),
-			E: int(big.NewInt(0).SetBytes(exponent).Uint64()),
-		}, nil
-	case "OKP":
-		// Ensure that the required fields are present and are strings.
-		x, ok := jwkMap["x"].(string)
-		if !ok {
-			return nil, ErrInvalidProof
+	case *rsa.PublicKey:
+		switch alg {
+		case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+			return true
 		}
+	case ed25519.PublicKey:
+		return alg == "EdDSA"
+	}
+	return false
+}
 
-		publicKey, err := base64urlTrailingPadding(x)
-		if err != nil {
-			return nil, err
+// Reads a JWK from the `jwk` header of a proof, inherently stripping it of unknown members.
+func jwkFromHeader(jwkMap map[string]interface{}) (*JWK, error) {
+	// Ensure that the members are strings, the JSON decoder would otherwise report a type error.
+	for _, member := range []string{"kty", "crv", "x", "y", "n", "e", "kid"} {
+		if value, ok := jwkMap[member]; ok {
+			if _, ok := value.(string); !ok {
+				return nil, ErrInvalidProof
+			}
 		}
+	}
+	if _, ok := jwkMap["kty"]; !ok {
+		return nil, ErrInvalidProof
+	}
 
-		return ed25519.PublicKey(publicKey), nil
-	case "OCT":
-		return nil, ErrUnsupportedKeyAlgorithm
-	default:
-		return nil, ErrUnsupportedKeyAlgorithm
+	b, err := json.Marshal(jwkMap)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidProof, err)
+	}
+	jwk := &JWK{}
+	if err := json.Unmarshal(b, jwk); err != nil {
+		return nil, errors.Join(ErrInvalidProof, err)
+	}
+	return jwk, nil
+}
+
+// Parses the `jwk` header of a proof into a public key.
+func parseJwk(jwkMap map[string]interface{}) (interface{}, error) {
+	jwk, err := jwkFromHeader(jwkMap)
+	if err != nil {
+		return nil, err
 	}
+	return jwk.PublicKey()
+}
+
+// Compares two strings in constant time so that the comparison does not leak how much of a secret value was guessed correctly.
+// Only the length of the strings can be learned from the time taken.
+func constantTimeEqual(a string, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
 }
 
 // Borrowed from MicahParks/keyfunc See: https://github.com/MicahParks/keyfunc/blob/master/keyfunc.go#L56
@@ -293,52 +354,3 @@ func base64urlTrailingPadding(s string) ([]byte, error) {
 	s = strings.TrimRight(s, "=")
 	return base64.RawURLEncoding.DecodeString(s)
 }
-
-// Strips eventual optional members of a JWK in order to be able to compute the thumbprint of it
-// https://datatracker.ietf.org/doc/html/rfc7638#section-3.2
-func getThumbprintableJwkJSONbytes(jwk map[string]interface{}) ([]byte, error) {
-	minimalJwk, err := parseJwk(jwk)
-	if err != nil {
-		return nil, err
-	}
-	jwkHeaderJSONBytes, err := getKeyStringRepresentation(minimalJwk)
-	if err != nil {
-		return nil, err
-	}
-	return jwkHeaderJSONBytes, nil
-}
-
-// Returns the string representation of a key in JSON format.
-func getKeyStringRepresentation(key interface{}) ([]byte, error) {
-	var keyParts interface{}
-	switch key := key.(type) {
-	case *ecdsa.PublicKey:
-		// Calculate the size of the byte array representation of an elliptic curve coordinate
-		// and ensure that the byte array representation of the key is padded correctly.
-		bits := key.Curve.Params().BitSize
-		keyCurveBytesSize := bits/8 + bits%8
-
-		keyParts = map[string]interface{}{
-			"kty": "EC",
-			"crv": key.Curve.Params().Name,
-			"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, keyCurveBytesSize))),
-			"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, keyCurveBytesSize))),
-		}
-	case *rsa.PublicKey:
-		keyParts = map[string]interface{}{
-			"kty": "RSA",
-			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
-			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
-		}
-	case ed25519.PublicKey:
-		keyParts = map[string]interface{}{
-			"kty": "OKP",
-			"crv": "Ed25519",
-			"x":   base64.RawURLEncoding.EncodeToString(key),
-		}
-	default:
-		return nil, ErrUnsupportedKeyAlgorithm
-	}
-
-	return json.Marshal(keyParts)
-}
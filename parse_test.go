@@ -635,8 +635,8 @@ func TestParse_ProofWithExtraKeyMembersEC(t *testing.T) {
 
 	// Set an optional member in the key used in the proof, the member should be disregarded in the thumbprint
 	jwkWithOptionalParameters := map[string]interface{}{
-		"x":   base64.RawURLEncoding.EncodeToString(privateKey.X.Bytes()),
-		"y":   base64.RawURLEncoding.EncodeToString(privateKey.Y.Bytes()),
+		"x":   base64.RawURLEncoding.EncodeToString(privateKey.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(privateKey.Y.FillBytes(make([]byte, 32))),
 		"ext": true,
 		"crv": privateKey.Curve.Params().Name,
 		"kty": "EC",
@@ -644,8 +644,8 @@ func TestParse_ProofWithExtraKeyMembersEC(t *testing.T) {
 
 	// Create a copy of the key without the optional member to be able to expect the stripped thumbprint
 	jwkWithoutOptionalParameters := map[string]interface{}{
-		"x":   base64.RawURLEncoding.EncodeToString(privateKey.X.Bytes()),
-		"y":   base64.RawURLEncoding.EncodeToString(privateKey.Y.Bytes()),
+		"x":   base64.RawURLEncoding.EncodeToString(privateKey.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(privateKey.Y.FillBytes(make([]byte, 32))),
 		"crv": privateKey.Curve.Params().Name,
 		"kty": "EC",
 	}
@@ -812,11 +812,11 @@ func TestParse_ProofWithExtraKeyMembersRSA(t *testing.T) {
 	token := &jwt.Token{
 		Header: map[string]interface{}{
 			"typ": "dpop+jwt",
-			"alg": jwt.SigningMethodRS512.Alg(),
+			"alg": jwt.SigningMethodRS256.Alg(),
 			"jwk": jwkWithOptionalParameters,
 		},
 		Claims: tokenClaims,
-		Method: jwt.SigningMethodRS512,
+		Method: jwt.SigningMethodRS256,
 	}
 	tokenString, err := token.SignedString(rsaKey)
 	if err != nil {
@@ -893,11 +893,11 @@ func TestParse_ProofWithMalformedJwkRSA(t *testing.T) {
 			token := &jwt.Token{
 				Header: map[string]interface{}{
 					"typ": "dpop+jwt",
-					"alg": jwt.SigningMethodRS512.Alg(),
+					"alg": jwt.SigningMethodRS256.Alg(),
 					"jwk": testCase,
 				},
 				Claims: tokenClaims,
-				Method: jwt.SigningMethodRS512,
+				Method: jwt.SigningMethodRS256,
 			}
 			tokenString, err := token.SignedString(rsaKey)
 			if err != nil {
@@ -1094,3 +1094,391 @@ func TestParse_ProofWithLeadingZeroesEC(t *testing.T) {
 		t.Errorf("Expected hashed public key to be %v, got %v", validES256LeadingZeroes_ath, proof.HashedPublicKey)
 	}
 }
+
+// Test that a proof signed with an algorithm that is not allowed is rejected
+func TestParse_ProofWithDisallowedAlgorithm(t *testing.T) {
+	// Arrange
+	httpUrl := url.URL{
+		Scheme: "https",
+		Host:   "server.example.com",
+		Path:   "/token",
+	}
+	duration := time.Duration(438000) * time.Hour
+	opts := dpop.ParseOptions{
+		AllowedProofAge:   &duration,
+		AllowedAlgorithms: []string{"EdDSA"},
+	}
+
+	// Act
+	proof, err := dpop.Parse(validES256_proof, dpop.POST, &httpUrl, opts)
+
+	// Assert
+	if err == nil {
+		t.Errorf("Expected error")
+	}
+	if err != nil {
+		AssertJoinedError(t, err, dpop.ErrUnsupportedAlgorithm)
+	}
+	if proof != nil {
+		t.Errorf("Expected nil token")
+	}
+}
+
+// Test that RS512 is only accepted when it is explicitly allowed
+func TestParse_ProofWithAlgorithmNotAllowedByDefault(t *testing.T) {
+	// Arrange
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := &jwt.Token{
+		Header: map[string]interface{}{
+			"typ": "dpop+jwt",
+			"alg": jwt.SigningMethodRS512.Alg(),
+			"jwk": map[string]interface{}{
+				"kty": "RSA",
+				"n":   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+			},
+		},
+		Claims: dpop.ProofTokenClaims{
+			RegisteredClaims: &jwt.RegisteredClaims{
+				ID:       "id",
+				IssuedAt: jwt.NewNumericDate(time.Now()),
+			},
+			Method: dpop.POST,
+			URL:    "https://server.example.com/token",
+		},
+		Method: jwt.SigningMethodRS512,
+	}
+	tokenString, err := token.SignedString(rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpUrl := url.URL{
+		Scheme: "https",
+		Host:   "server.example.com",
+		Path:   "/token",
+	}
+
+	// Act
+	_, defaultErr := dpop.Parse(tokenString, dpop.POST, &httpUrl, dpop.ParseOptions{})
+	proof, allowedErr := dpop.Parse(tokenString, dpop.POST, &httpUrl, dpop.ParseOptions{
+		AllowedAlgorithms: append(dpop.DefaultAllowedAlgorithms(), "RS512"),
+	})
+
+	// Assert
+	if defaultErr == nil {
+		t.Errorf("Expected error")
+	}
+	if defaultErr != nil {
+		AssertJoinedError(t, defaultErr, dpop.ErrUnsupportedAlgorithm)
+	}
+	if allowedErr != nil {
+		t.Errorf("Unexpected error: %v", allowedErr)
+	}
+	if proof == nil {
+		t.Errorf("Expected proof to be parsed")
+	}
+}
+
+// Test that a proof whose `alg` does not match the curve of the `jwk` is rejected
+func TestParse_ProofWithAlgorithmNotMatchingKey(t *testing.T) {
+	// Arrange
+	signingKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headerKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := &jwt.Token{
+		Header: map[string]interface{}{
+			"typ": "dpop+jwt",
+			"alg": jwt.SigningMethodES256.Alg(),
+			"jwk": map[string]interface{}{
+				"kty": "EC",
+				"crv": "P-384",
+				"x":   base64.RawURLEncoding.EncodeToString(headerKey.X.FillBytes(make([]byte, 48))),
+				"y":   base64.RawURLEncoding.EncodeToString(headerKey.Y.FillBytes(make([]byte, 48))),
+			},
+		},
+		Claims: dpop.ProofTokenClaims{
+			RegisteredClaims: &jwt.RegisteredClaims{
+				ID:       "id",
+				IssuedAt: jwt.NewNumericDate(time.Now()),
+			},
+			Method: dpop.POST,
+			URL:    "https://server.example.com/token",
+		},
+		Method: jwt.SigningMethodES256,
+	}
+	tokenString, err := token.SignedString(signingKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpUrl := url.URL{
+		Scheme: "https",
+		Host:   "server.example.com",
+		Path:   "/token",
+	}
+
+	// Act
+	proof, err := dpop.Parse(tokenString, dpop.POST, &httpUrl, dpop.ParseOptions{})
+
+	// Assert
+	if err == nil {
+		t.Errorf("Expected error")
+	}
+	if err != nil {
+		AssertJoinedError(t, err, dpop.ErrAlgorithmMismatch)
+	}
+	if proof != nil {
+		t.Errorf("Expected nil token")
+	}
+}
+
+// Test that a proof with an EC key that is not a valid point on the curve is rejected
+func TestParse_ProofWithInvalidCurvePointEC(t *testing.T) {
+	// Arrange
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := privateKey.X.FillBytes(make([]byte, 32))
+	y := privateKey.Y.FillBytes(make([]byte, 32))
+	offCurveY := new(big.Int).Add(privateKey.Y, big.NewInt(1)).FillBytes(make([]byte, 32))
+
+	tokenClaims := dpop.ProofTokenClaims{
+		RegisteredClaims: &jwt.RegisteredClaims{
+			ID:       "random_id",
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+		Method: dpop.POST,
+		URL:    "https://server.example.com/token",
+	}
+	httpUrl := url.URL{
+		Scheme: "https",
+		Host:   "server.example.com",
+		Path:   "/token",
+	}
+
+	testCases := map[string]map[string]interface{}{
+		"off curve": {
+			"x":   base64.RawURLEncoding.EncodeToString(x),
+			"y":   base64.RawURLEncoding.EncodeToString(offCurveY),
+			"crv": "P-256",
+			"kty": "EC",
+		},
+		"short coordinate": {
+			"x":   base64.RawURLEncoding.EncodeToString(x[1:]),
+			"y":   base64.RawURLEncoding.EncodeToString(y),
+			"crv": "P-256",
+			"kty": "EC",
+		},
+		"long coordinate": {
+			"x":   base64.RawURLEncoding.EncodeToString(x),
+			"y":   base64.RawURLEncoding.EncodeToString(append([]byte{0}, y...)),
+			"crv": "P-256",
+			"kty": "EC",
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			token := &jwt.Token{
+				Header: map[string]interface{}{
+					"typ": "dpop+jwt",
+					"alg": jwt.SigningMethodES256.Alg(),
+					"jwk": testCase,
+				},
+				Claims: tokenClaims,
+				Method: jwt.SigningMethodES256,
+			}
+			tokenString, err := token.SignedString(privateKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Act
+			proof, err := dpop.Parse(tokenString, dpop.POST, &httpUrl, dpop.ParseOptions{})
+
+			// Assert
+			if err == nil {
+				t.Errorf("Expected error")
+			}
+			if err != nil {
+				AssertJoinedError(t, err, dpop.ErrInvalidCurvePoint)
+			}
+			if proof != nil {
+				t.Errorf("Expected nil token")
+			}
+		})
+	}
+}
+
+// Test that a proof with a RSA key smaller than the minimum size is rejected unless allowed by the options
+func TestParse_ProofWithSmallRSAKey(t *testing.T) {
+	// Arrange
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := &dpop.ProofTokenClaims{
+		RegisteredClaims: &jwt.RegisteredClaims{
+			ID:       "id",
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+		Method: dpop.POST,
+		URL:    "https://server.example.com/token",
+	}
+	tokenString, err := dpop.Create(jwt.SigningMethodRS256, claims, rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpUrl := url.URL{
+		Scheme: "https",
+		Host:   "server.example.com",
+		Path:   "/token",
+	}
+
+	// Act
+	proof, err := dpop.Parse(tokenString, dpop.POST, &httpUrl, dpop.ParseOptions{})
+
+	// Assert
+	if err == nil {
+		t.Errorf("Expected error")
+	}
+	if err != nil {
+		AssertJoinedError(t, err, dpop.ErrRSAKeyTooSmall)
+	}
+	if proof != nil {
+		t.Errorf("Expected nil token")
+	}
+
+	// Act
+	proof, err = dpop.Parse(tokenString, dpop.POST, &httpUrl, dpop.ParseOptions{MinimumRSAKeySize: 1024})
+
+	// Assert
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if proof == nil || proof.Valid != true {
+		t.Errorf("Expected token to be valid")
+	}
+}
+
+// Test that a proof with an invalid RSA exponent is rejected
+func TestParse_ProofWithInvalidRSAExponent(t *testing.T) {
+	// Arrange
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenClaims := dpop.ProofTokenClaims{
+		RegisteredClaims: &jwt.RegisteredClaims{
+			ID:       "id",
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+		Method: dpop.POST,
+		URL:    "https://server.example.com/token",
+	}
+	httpUrl := url.URL{
+		Scheme: "https",
+		Host:   "server.example.com",
+		Path:   "/token",
+	}
+
+	testCases := map[string][]byte{
+		"one":      {1},
+		"even":     {1, 0, 0},
+		"too long": {1, 0, 0, 0, 0, 0, 0, 0, 1},
+	}
+
+	for name, exponent := range testCases {
+		t.Run(name, func(t *testing.T) {
+			token := &jwt.Token{
+				Header: map[string]interface{}{
+					"typ": "dpop+jwt",
+					"alg": jwt.SigningMethodRS256.Alg(),
+					"jwk": map[string]interface{}{
+						"kty": "RSA",
+						"n":   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+						"e":   base64.RawURLEncoding.EncodeToString(exponent),
+					},
+				},
+				Claims: tokenClaims,
+				Method: jwt.SigningMethodRS256,
+			}
+			tokenString, err := token.SignedString(rsaKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Act
+			proof, err := dpop.Parse(tokenString, dpop.POST, &httpUrl, dpop.ParseOptions{})
+
+			// Assert
+			if err == nil {
+				t.Errorf("Expected error")
+			}
+			if err != nil {
+				AssertJoinedError(t, err, dpop.ErrInvalidRSAExponent)
+			}
+			if proof != nil {
+				t.Errorf("Expected nil token")
+			}
+		})
+	}
+}
+
+// Test that the constant time comparisons of `nonce` and `dpop_jkt` reject values that only share a prefix or differ in length
+func TestParse_PartiallyMatchingNonceAndJkt(t *testing.T) {
+	// Arrange
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jkt, err := dpop.JKT(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := mustParseURL(t, "https://server.example.com/token")
+	nonce := "eyJ7S_zG.eyJH0-Z.HX4w-7v"
+	proofString := createTestProof(t, key, dpop.POST, u.String(), "", nonce)
+
+	testCases := []struct {
+		name     string
+		opts     dpop.ParseOptions
+		expected error
+	}{
+		{name: "nonce prefix", opts: dpop.ParseOptions{Nonce: nonce[:len(nonce)-1]}, expected: dpop.ErrIncorrectNonce},
+		{name: "nonce suffix added", opts: dpop.ParseOptions{Nonce: nonce + "A"}, expected: dpop.ErrIncorrectNonce},
+		{name: "nonce last character", opts: dpop.ParseOptions{Nonce: nonce[:len(nonce)-1] + "x"}, expected: dpop.ErrIncorrectNonce},
+		{name: "jkt prefix", opts: dpop.ParseOptions{Nonce: nonce, JKT: jkt[:len(jkt)-1]}, expected: dpop.ErrIncorrectJKT},
+		{name: "jkt last character", opts: dpop.ParseOptions{Nonce: nonce, JKT: jkt[:len(jkt)-1] + "x"}, expected: dpop.ErrIncorrectJKT},
+		{name: "matching", opts: dpop.ParseOptions{Nonce: nonce, JKT: jkt}, expected: nil},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			// Act
+			proof, err := dpop.Parse(proofString, dpop.POST, u, testCase.opts)
+
+			// Assert
+			if testCase.expected == nil {
+				if err != nil || proof == nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, testCase.expected) {
+				t.Errorf("Expected error %v, got %v", testCase.expected, err)
+			}
+			if proof != nil {
+				t.Errorf("Expected nil token")
+			}
+		})
+	}
+}
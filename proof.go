@@ -1,6 +1,8 @@
 package dpop
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
 	"errors"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -57,10 +59,59 @@ type Proof struct {
 // The bound access token should be validated before calling this function
 // and the claims of the introspected bound access token needs to be of the BoundAccessTokenClaims type.
 //
-// The access token hash needs to be a URL encoded SHA256 hash of the access token.
+// The access token hash needs to be a URL encoded SHA256 hash of the access token, as returned by AccessTokenHash.
+// ValidateAccessToken computes the hash itself and does not require a parsed access token.
 //
 // If no error is returned the proof is valid for the supplied bound token.
 func (t *Proof) Validate(accessTokenHash []byte, boundAccessTokenJWT *jwt.Token) error {
+	// Make sure bound access token claims are of the correct type, this is checked after the proof claims.
+	var boundClaims BoundClaims
+	if boundAccessTokenJWT != nil {
+		boundClaims, _ = boundAccessTokenJWT.Claims.(BoundClaims)
+	}
+	return t.validate(string(accessTokenHash), boundClaims)
+}
+
+// ValidateAccessToken validates that the proof is bound to the raw access token and that the access token is bound to the key of the proof.
+// This satisfies point 12 in https://datatracker.ietf.org/doc/html/rfc9449#section-4.3
+//
+// Unlike Validate the `ath` claim is computed from the access token with AccessTokenHash.
+//
+// The claims of the access token should be verified before calling this function.
+//
+// If no error is returned the proof is valid for the supplied bound token.
+func (t *Proof) ValidateAccessToken(rawToken string, boundClaims BoundClaims) error {
+	return t.validate(AccessTokenHash(rawToken), boundClaims)
+}
+
+// ValidateJKT validates that the proof is bound to the raw access token and that its key has the expected thumbprint.
+// This satisfies point 12 in https://datatracker.ietf.org/doc/html/rfc9449#section-4.3
+//
+// The expected thumbprint is the `cnf.jkt` value of the access token, which allows access tokens
+// verified by other JOSE libraries, PASETO or introspection to be checked without golang-jwt.
+//
+// The access token should be verified before calling this function.
+//
+// If no error is returned the proof is valid for the supplied bound token.
+func (t *Proof) ValidateJKT(rawToken string, jkt string) error {
+	return t.validate(AccessTokenHash(rawToken), expectedJKT(jkt))
+}
+
+// Implemented by the claims of bound access tokens, or anything else holding the thumbprint of their key.
+type jwkThumbprintGetter interface {
+	GetJWKThumbprint() (string, error)
+}
+
+// The thumbprint supplied to ValidateJKT.
+type expectedJKT string
+
+func (j expectedJKT) GetJWKThumbprint() (string, error) {
+	return string(j), nil
+}
+
+// Validates the binding of the proof to an access token with the supplied hash and claims.
+// The `ath` and `jkt` values are compared in constant time.
+func (t *Proof) validate(accessTokenHash string, boundClaims jwkThumbprintGetter) error {
 	// Make sure the proof token claims are of the correct type.
 	claims, ok := t.Claims.(ProofClaims)
 	if !ok {
@@ -78,7 +129,7 @@ func (t *Proof) Validate(accessTokenHash []byte, boundAccessTokenJWT *jwt.Token)
 	}
 
 	// Control that bound token in proof matches supplied token
-	if proofAccessTokenHash != string(accessTokenHash) {
+	if !constantTimeEqual(proofAccessTokenHash, accessTokenHash) {
 		return errors.Join(ErrInvalidProof, ErrAthMismatch)
 	}
 
@@ -88,24 +139,32 @@ func (t *Proof) Validate(accessTokenHash []byte, boundAccessTokenJWT *jwt.Token)
 		return errors.Join(ErrInvalidProof, ErrMissingJWK)
 	}
 
-	// Make sure bound access token claims are of the correct type.
-	boundTokenClaims, ok := (boundAccessTokenJWT.Claims).(BoundClaims)
-	if !ok {
+	if boundClaims == nil {
 		return ErrIncorrectAccessTokenClaimsType
 	}
 
 	// Check that key in proof matches bound token key
-	jkt, err := boundTokenClaims.GetJWKThumbprint()
+	jkt, err := boundClaims.GetJWKThumbprint()
 	if err != nil {
 		return errors.Join(ErrIncorrectAccessTokenClaimsType, err)
 	}
-	if jkt != b64URLjwkHash {
+	if !constantTimeEqual(jkt, b64URLjwkHash) {
 		return errors.Join(ErrInvalidProof, ErrJWKMismatch)
 	}
 
 	return nil
 }
 
+// AccessTokenHash returns the `ath` claim of a proof bound to the access token,
+// which is the base64url encoded SHA-256 hash of the access token.
+// See https://datatracker.ietf.org/doc/html/rfc9449#section-4.2
+//
+// It can be used by clients creating bound proofs and as the access token hash supplied to Validate.
+func AccessTokenHash(accessToken string) string {
+	h := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
 // Get the public key from the proof.
 //
 // The public key string is base64 and url encoded according to https://datatracker.ietf.org/doc/html/draft-ietf-oauth-dpop#section-6.1
@@ -329,3 +329,184 @@ func TestValidate_WithCustomClaims(t *testing.T) {
 		t.Errorf("Validate returned error: %v", err)
 	}
 }
+
+// Test that the access token hash matches the example in https://datatracker.ietf.org/doc/html/rfc9449#section-7.1
+func TestAccessTokenHash(t *testing.T) {
+	// Act
+	ath := dpop.AccessTokenHash("Kz~8mXK1EalYznwH-LC-1fBAo.4Ljp~zsPE_NeO.gxU")
+
+	// Assert
+	if ath != "fUHyO2r2Z3DZ53EsNrWBb0xWXoaNy59IiKCAqksmQEo" {
+		t.Errorf("Unexpected access token hash %s", ath)
+	}
+}
+
+// Test that a proof bound to a raw access token is accepted
+func TestValidateAccessToken_WithValidProofAndBoundAccessToken(t *testing.T) {
+	// Arrange
+	accessToken := "someToken"
+	underTest := dpop.Proof{
+		Token: &jwt.Token{
+			Claims: &dpop.ProofTokenClaims{
+				AccessTokenHash: dpop.AccessTokenHash(accessToken),
+			},
+		},
+		HashedPublicKey: "jkt",
+	}
+	boundClaims := &dpop.BoundAccessTokenClaims{
+		Confirmation: dpop.Confirmation{JWKThumbprint: "jkt"},
+	}
+
+	// Act
+	err := underTest.ValidateAccessToken(accessToken, boundClaims)
+
+	// Assert
+	if err != nil {
+		t.Errorf("ValidateAccessToken returned error: %v", err)
+	}
+}
+
+// Test that ValidateAccessToken rejects proofs that are not bound to the access token or its key
+func TestValidateAccessToken_WithIncorrectBinding(t *testing.T) {
+	accessToken := "someToken"
+	testCases := []struct {
+		name        string
+		ath         string
+		jkt         string
+		boundClaims dpop.BoundClaims
+		expected    error
+	}{
+		{name: "missing ath", ath: "", jkt: "jkt", boundClaims: &dpop.BoundAccessTokenClaims{Confirmation: dpop.Confirmation{JWKThumbprint: "jkt"}}, expected: dpop.ErrMissingAth},
+		{name: "incorrect ath", ath: dpop.AccessTokenHash("otherToken"), jkt: "jkt", boundClaims: &dpop.BoundAccessTokenClaims{Confirmation: dpop.Confirmation{JWKThumbprint: "jkt"}}, expected: dpop.ErrAthMismatch},
+		{name: "missing jwk", ath: dpop.AccessTokenHash(accessToken), jkt: "", boundClaims: &dpop.BoundAccessTokenClaims{Confirmation: dpop.Confirmation{JWKThumbprint: "jkt"}}, expected: dpop.ErrMissingJWK},
+		{name: "incorrect jkt", ath: dpop.AccessTokenHash(accessToken), jkt: "jkt", boundClaims: &dpop.BoundAccessTokenClaims{Confirmation: dpop.Confirmation{JWKThumbprint: "other"}}, expected: dpop.ErrJWKMismatch},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			// Arrange
+			underTest := dpop.Proof{
+				Token: &jwt.Token{
+					Claims: &dpop.ProofTokenClaims{
+						AccessTokenHash: testCase.ath,
+					},
+				},
+				HashedPublicKey: testCase.jkt,
+			}
+
+			// Act
+			err := underTest.ValidateAccessToken(accessToken, testCase.boundClaims)
+
+			// Assert
+			AssertJoinedError(t, err, testCase.expected)
+		})
+	}
+}
+
+// Test that ValidateAccessToken rejects missing bound claims
+func TestValidateAccessToken_WithMissingBoundClaims(t *testing.T) {
+	// Arrange
+	accessToken := "someToken"
+	underTest := dpop.Proof{
+		Token: &jwt.Token{
+			Claims: &dpop.ProofTokenClaims{
+				AccessTokenHash: dpop.AccessTokenHash(accessToken),
+			},
+		},
+		HashedPublicKey: "jkt",
+	}
+
+	// Act
+	err := underTest.ValidateAccessToken(accessToken, nil)
+
+	// Assert
+	if !errors.Is(err, dpop.ErrIncorrectAccessTokenClaimsType) {
+		t.Errorf("Expected error %v, got %v", dpop.ErrIncorrectAccessTokenClaimsType, err)
+	}
+}
+
+// Test that the constant time comparisons of `ath` and `jkt` reject values that only share a prefix or differ in length
+func TestValidate_WithPartiallyMatchingBinding(t *testing.T) {
+	ath := dpop.AccessTokenHash("someToken")
+	jkt := "0ZcOCORZNYy-DWpqq30jZyJGHTN0d2HglBV3uiguA4I"
+	testCases := []struct {
+		name     string
+		ath      string
+		jkt      string
+		expected error
+	}{
+		{name: "ath prefix", ath: ath[:len(ath)-1], jkt: jkt, expected: dpop.ErrAthMismatch},
+		{name: "ath suffix added", ath: ath + "A", jkt: jkt, expected: dpop.ErrAthMismatch},
+		{name: "ath last character", ath: ath[:len(ath)-1] + "x", jkt: jkt, expected: dpop.ErrAthMismatch},
+		{name: "jkt prefix", ath: ath, jkt: jkt[:len(jkt)-1], expected: dpop.ErrJWKMismatch},
+		{name: "jkt last character", ath: ath, jkt: jkt[:len(jkt)-1] + "x", expected: dpop.ErrJWKMismatch},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			// Arrange
+			underTest := dpop.Proof{
+				Token: &jwt.Token{
+					Claims: &dpop.ProofTokenClaims{
+						AccessTokenHash: ath,
+					},
+				},
+				HashedPublicKey: jkt,
+			}
+			boundToken := &jwt.Token{
+				Claims: &dpop.BoundAccessTokenClaims{
+					Confirmation: dpop.Confirmation{JWKThumbprint: testCase.jkt},
+				},
+			}
+
+			// Act
+			err := underTest.Validate([]byte(testCase.ath), boundToken)
+
+			// Assert
+			AssertJoinedError(t, err, testCase.expected)
+		})
+	}
+}
+
+// Test that a proof can be validated against the expected thumbprint of an access token verified without golang-jwt
+func TestValidateJKT(t *testing.T) {
+	accessToken := "someToken"
+	testCases := []struct {
+		name     string
+		ath      string
+		jkt      string
+		expected error
+	}{
+		{name: "valid", ath: dpop.AccessTokenHash(accessToken), jkt: "jkt", expected: nil},
+		{name: "missing ath", ath: "", jkt: "jkt", expected: dpop.ErrMissingAth},
+		{name: "incorrect ath", ath: dpop.AccessTokenHash("otherToken"), jkt: "jkt", expected: dpop.ErrAthMismatch},
+		{name: "incorrect jkt", ath: dpop.AccessTokenHash(accessToken), jkt: "other", expected: dpop.ErrJWKMismatch},
+		{name: "empty jkt", ath: dpop.AccessTokenHash(accessToken), jkt: "", expected: dpop.ErrJWKMismatch},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			// Arrange
+			underTest := dpop.Proof{
+				Token: &jwt.Token{
+					Claims: &dpop.ProofTokenClaims{
+						AccessTokenHash: testCase.ath,
+					},
+				},
+				HashedPublicKey: "jkt",
+			}
+
+			// Act
+			err := underTest.ValidateJKT(accessToken, testCase.jkt)
+
+			// Assert
+			if testCase.expected == nil {
+				if err != nil {
+					t.Errorf("ValidateJKT returned error: %v", err)
+				}
+				return
+			}
+			AssertJoinedError(t, err, testCase.expected)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package dpop
+
+import (
+	"crypto"
+	"encoding/json"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ProofOptions and its contents are optional for the NewProof function.
+type ProofOptions struct {
+	// The `nonce` claim, a nonce provided by the server. See https://datatracker.ietf.org/doc/html/rfc9449#section-8
+	Nonce string
+
+	// The access token that proofs are bound to with the `ath` claim. See https://datatracker.ietf.org/doc/html/rfc9449#section-7
+	AccessToken string
+
+	// Additional claims of the proofs. They can not override the claims set by the ProofBuilder.
+	Claims map[string]interface{}
+
+	// The method used to sign proofs. If not set it is chosen from the type of the key.
+	SigningMethod jwt.SigningMethod
+
+	// Used to get the `iat` claim. If not set time.Now is used.
+	Now func() time.Time
+}
+
+// ProofBuilder creates signed proofs for requests with the same HTTP method and URL.
+type ProofBuilder struct {
+	method HTTPVerb
+	htu    string
+	opts   ProofOptions
+}
+
+// NewProof creates a ProofBuilder for requests with the supplied HTTP method to the supplied URL.
+//
+// The URL is normalized with NormalizeHTU, which strips its query and fragment.
+func NewProof(method HTTPVerb, rawURL string, opts ProofOptions) (*ProofBuilder, error) {
+	htu, err := NormalizeHTU(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &ProofBuilder{
+		method: method,
+		htu:    htu,
+		opts:   opts,
+	}, nil
+}
+
+// Sign creates a proof signed with the supplied key.
+//
+// Every proof gets a new cryptographically random `jti` and the current time as `iat`,
+// so that a new proof is created for every request. See https://datatracker.ietf.org/doc/html/rfc9449#section-4.2
+func (b *ProofBuilder) Sign(key crypto.Signer) (string, error) {
+	jti, err := randomID()
+	if err != nil {
+		return "", err
+	}
+
+	claims := &ProofTokenClaims{
+		RegisteredClaims: &jwt.RegisteredClaims{
+			ID:       jti,
+			IssuedAt: jwt.NewNumericDate(b.opts.Now()),
+		},
+		Method: b.method,
+		URL:    b.htu,
+		Nonce:  b.opts.Nonce,
+	}
+	if b.opts.AccessToken != "" {
+		claims.AccessTokenHash = AccessTokenHash(b.opts.AccessToken)
+	}
+	if len(b.opts.Claims) == 0 {
+		return Create(b.opts.SigningMethod, claims, key)
+	}
+	return Create(b.opts.SigningMethod, &extendedProofClaims{ProofTokenClaims: claims, extra: b.opts.Claims}, key)
+}
+
+// Proof claims with additional claims.
+type extendedProofClaims struct {
+	*ProofTokenClaims
+	extra map[string]interface{}
+}
+
+// Marshals the additional claims together with the proof claims, which take precedence.
+func (c *extendedProofClaims) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(c.ProofTokenClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := make(map[string]interface{}, len(c.extra))
+	for key, value := range c.extra {
+		claims[key] = value
+	}
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return nil, err
+	}
+	return json.Marshal(claims)
+}
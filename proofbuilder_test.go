@@ -0,0 +1,167 @@
+package dpop_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AxisCommunications/go-dpop"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Test that a built proof is accepted by Parse and bound to the access token
+func TestNewProof(t *testing.T) {
+	// Arrange
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder, err := dpop.NewProof(dpop.GET, "https://Server.example.com:443/resource?id=1#fragment", dpop.ProofOptions{
+		Nonce:       "nonce",
+		AccessToken: "access-token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	proofString, err := builder.Sign(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := dpop.Parse(proofString, dpop.GET, mustParseURL(t, "https://server.example.com/resource"), dpop.ParseOptions{
+		Nonce: "nonce",
+	})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	claims := proof.Claims.(*dpop.ProofTokenClaims)
+	if claims.URL != "https://server.example.com/resource" {
+		t.Errorf("Expected htu without query and fragment, got %s", claims.URL)
+	}
+	if err := proof.ValidateJKT("access-token", proof.PublicKey()); err != nil {
+		t.Errorf("Expected proof to be bound to the access token: %v", err)
+	}
+}
+
+// Test that every signed proof gets a new `jti` and the `iat` of the clock
+func TestNewProof_JTIAndClock(t *testing.T) {
+	// Arrange
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	builder, err := dpop.NewProof(dpop.POST, "https://server.example.com/token", dpop.ProofOptions{
+		Now: func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	first, err := builder.Sign(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := builder.Sign(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Assert
+	firstClaims := parseUnverifiedProofClaims(t, first)
+	secondClaims := parseUnverifiedProofClaims(t, second)
+	if firstClaims.ID == "" || firstClaims.ID == secondClaims.ID {
+		t.Errorf("Expected unique jti, got %q and %q", firstClaims.ID, secondClaims.ID)
+	}
+	if !firstClaims.IssuedAt.Time.Equal(now) {
+		t.Errorf("Expected iat %v, got %v", now, firstClaims.IssuedAt.Time)
+	}
+}
+
+// Test that additional claims are included but can not override the claims of the proof
+func TestNewProof_Claims(t *testing.T) {
+	// Arrange
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder, err := dpop.NewProof(dpop.POST, "https://server.example.com/token", dpop.ProofOptions{
+		Claims: map[string]interface{}{"client_id": "client", "htm": "GET", "jti": "fixed"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	proofString, err := builder.Sign(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := jwt.MapClaims{}
+	_, _, err = jwt.NewParser().ParseUnverified(proofString, claims)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["client_id"] != "client" || claims["htm"] != "POST" || claims["jti"] == "fixed" {
+		t.Errorf("Unexpected claims %v", claims)
+	}
+}
+
+// Test that the signing method is chosen from the type of the key
+func TestNewProof_SigningMethod(t *testing.T) {
+	// Arrange
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder, err := dpop.NewProof(dpop.POST, "https://server.example.com/token", dpop.ProofOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	proofString, err := builder.Sign(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := jwt.NewParser().ParseUnverified(proofString, &dpop.ProofTokenClaims{})
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Header["alg"] != jwt.SigningMethodEdDSA.Alg() {
+		t.Errorf("Expected alg %s, got %v", jwt.SigningMethodEdDSA.Alg(), token.Header["alg"])
+	}
+}
+
+// Test that a URL without scheme and host is rejected
+func TestNewProof_InvalidURL(t *testing.T) {
+	// Act
+	_, err := dpop.NewProof(dpop.POST, "/token", dpop.ProofOptions{})
+
+	// Assert
+	if !errors.Is(err, dpop.ErrInvalidHTU) {
+		t.Errorf("Expected error %v, got %v", dpop.ErrInvalidHTU, err)
+	}
+}
+
+// Helper function to read the claims of a proof without verifying it.
+func parseUnverifiedProofClaims(t *testing.T, proofString string) *dpop.ProofTokenClaims {
+	t.Helper()
+	claims := &dpop.ProofTokenClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(proofString, claims); err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
@@ -0,0 +1,135 @@
+package dpop
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// RefreshTokenBindingStore stores the `jkt` that refresh tokens are bound to.
+//
+// Refresh tokens are identified by their base64url encoded SHA-256 hash so that stores never hold raw tokens.
+type RefreshTokenBindingStore interface {
+	// SaveRefreshTokenBinding stores the `jkt` of a refresh token until it expires.
+	// A zero expiry means that the binding does not expire.
+	SaveRefreshTokenBinding(ctx context.Context, tokenHash string, jkt string, expiry time.Time) error
+
+	// LoadRefreshTokenBinding returns the `jkt` of a refresh token.
+	// An empty string is returned if the refresh token is not bound.
+	// If the binding has expired ErrExpiredBinding is returned, so that the token is rejected instead of treated as unbound.
+	LoadRefreshTokenBinding(ctx context.Context, tokenHash string) (string, error)
+
+	// DeleteRefreshTokenBinding removes the binding of a refresh token, for example when it is rotated or revoked.
+	DeleteRefreshTokenBinding(ctx context.Context, tokenHash string) error
+}
+
+// RefreshTokenBindings binds refresh tokens to the key of the proof of the token request they were issued in.
+//
+// Refresh tokens issued to public clients must be bound and can only be used with proofs signed by the same key.
+// See https://datatracker.ietf.org/doc/html/rfc9449#section-5
+type RefreshTokenBindings struct {
+	store RefreshTokenBindingStore
+}
+
+// NewRefreshTokenBindings creates RefreshTokenBindings that keeps bindings in the supplied store.
+func NewRefreshTokenBindings(store RefreshTokenBindingStore) *RefreshTokenBindings {
+	return &RefreshTokenBindings{store: store}
+}
+
+// Bind records the key of the proof against an issued refresh token.
+// The binding should expire together with the refresh token, a zero expiry means that the binding does not expire.
+func (b *RefreshTokenBindings) Bind(ctx context.Context, refreshToken string, proof *Proof, expiry time.Time) error {
+	if proof == nil || proof.PublicKey() == "" {
+		return ErrMissingJWK
+	}
+	return b.store.SaveRefreshTokenBinding(ctx, AccessTokenHash(refreshToken), proof.PublicKey(), expiry)
+}
+
+// Verify checks that a refresh request carries a proof signed by the key the refresh token is bound to.
+//
+// Refresh tokens that are not bound, such as those issued to confidential clients, are accepted.
+// As a store can not tell a binding that has been removed from one that never existed,
+// this includes bound refresh tokens whose bindings have been removed.
+// Use VerifyBound for refresh tokens of public clients, which must be bound.
+// A proof signed by another key is rejected with an ErrIncorrectJKT error joined with ErrInvalidProof
+// and a refresh token with an expired binding is rejected with ErrExpiredBinding.
+func (b *RefreshTokenBindings) Verify(ctx context.Context, refreshToken string, proof *Proof) error {
+	return b.verify(ctx, refreshToken, proof, false)
+}
+
+// VerifyBound checks that a refresh token is bound and that the refresh request carries a proof signed by the bound key.
+//
+// Refresh tokens of public clients must be bound, so a token without a binding is rejected with ErrMissingBinding.
+// See Verify for the other errors.
+func (b *RefreshTokenBindings) VerifyBound(ctx context.Context, refreshToken string, proof *Proof) error {
+	return b.verify(ctx, refreshToken, proof, true)
+}
+
+func (b *RefreshTokenBindings) verify(ctx context.Context, refreshToken string, proof *Proof, required bool) error {
+	jkt, err := b.store.LoadRefreshTokenBinding(ctx, AccessTokenHash(refreshToken))
+	if err != nil {
+		return err
+	}
+	if jkt == "" {
+		if required {
+			return ErrMissingBinding
+		}
+		return nil
+	}
+	if proof == nil || !constantTimeEqual(jkt, proof.PublicKey()) {
+		return errors.Join(ErrInvalidProof, ErrIncorrectJKT)
+	}
+	return nil
+}
+
+// Revoke removes the binding of a refresh token.
+func (b *RefreshTokenBindings) Revoke(ctx context.Context, refreshToken string) error {
+	return b.store.DeleteRefreshTokenBinding(ctx, AccessTokenHash(refreshToken))
+}
+
+// MemoryRefreshTokenBindingStore is a RefreshTokenBindingStore that keeps bindings in memory.
+// It is safe for concurrent use.
+type MemoryRefreshTokenBindingStore struct {
+	mu       sync.Mutex
+	bindings *expiringBindings
+}
+
+// NewMemoryRefreshTokenBindingStore creates an empty MemoryRefreshTokenBindingStore.
+func NewMemoryRefreshTokenBindingStore() *MemoryRefreshTokenBindingStore {
+	return &MemoryRefreshTokenBindingStore{
+		bindings: newExpiringBindings(),
+	}
+}
+
+// Implement the RefreshTokenBindingStore interface.
+//
+// Bindings that expired more than EXPIRED_BINDING_RETENTION ago are removed whenever a new binding is saved.
+func (s *MemoryRefreshTokenBindingStore) SaveRefreshTokenBinding(ctx context.Context, tokenHash string, jkt string, expiry time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.bindings.save(tokenHash, jkt, expiry, time.Now())
+	return nil
+}
+
+// Implement the RefreshTokenBindingStore interface.
+func (s *MemoryRefreshTokenBindingStore) LoadRefreshTokenBinding(ctx context.Context, tokenHash string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jkt, err := s.bindings.load(tokenHash, time.Now())
+	if errors.Is(err, ErrMissingBinding) {
+		return "", nil
+	}
+	return jkt, err
+}
+
+// Implement the RefreshTokenBindingStore interface.
+func (s *MemoryRefreshTokenBindingStore) DeleteRefreshTokenBinding(ctx context.Context, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.bindings.delete(tokenHash)
+	return nil
+}
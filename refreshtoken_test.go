@@ -0,0 +1,198 @@
+package dpop_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AxisCommunications/go-dpop"
+)
+
+// Helper function to parse a proof for a refresh request signed by the supplied key.
+func parseTestRefreshProof(t *testing.T, key *ecdsa.PrivateKey) *dpop.Proof {
+	t.Helper()
+	proof, err := dpop.Parse(createTestProof(t, key, dpop.POST, testTokenURL, "", ""), dpop.POST, mustParseURL(t, testTokenURL), dpop.ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proof
+}
+
+// Test that a bound refresh token is only accepted with a proof signed by the bound key
+func TestRefreshTokenBindings_Verify(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	underTest := dpop.NewRefreshTokenBindings(dpop.NewMemoryRefreshTokenBindingStore())
+	if err := underTest.Bind(context.Background(), "refresh-token", parseTestRefreshProof(t, key), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name         string
+		refreshToken string
+		key          *ecdsa.PrivateKey
+		expected     error
+	}{
+		{name: "bound key", refreshToken: "refresh-token", key: key, expected: nil},
+		{name: "other key", refreshToken: "refresh-token", key: otherKey, expected: dpop.ErrIncorrectJKT},
+		{name: "unbound token", refreshToken: "other-refresh-token", key: otherKey, expected: nil},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			// Act
+			err := underTest.Verify(context.Background(), testCase.refreshToken, parseTestRefreshProof(t, testCase.key))
+
+			// Assert
+			if testCase.expected == nil {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			AssertJoinedError(t, err, testCase.expected)
+		})
+	}
+}
+
+// Test that a refresh token is no longer bound after it has been revoked and that an expired binding is rejected
+func TestRefreshTokenBindings_RevokeAndExpiry(t *testing.T) {
+	// Arrange
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := dpop.NewMemoryRefreshTokenBindingStore()
+	underTest := dpop.NewRefreshTokenBindings(store)
+	proof := parseTestRefreshProof(t, key)
+	if err := underTest.Bind(context.Background(), "revoked", proof, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := underTest.Bind(context.Background(), "expired", proof, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	err = underTest.Revoke(context.Background(), "revoked")
+	revokedErr := underTest.Verify(context.Background(), "revoked", parseTestRefreshProof(t, otherKey))
+	expiredErr := underTest.Verify(context.Background(), "expired", parseTestRefreshProof(t, key))
+
+	// Assert
+	if err != nil || revokedErr != nil {
+		t.Errorf("Unexpected errors: %v, %v", err, revokedErr)
+	}
+	if !errors.Is(expiredErr, dpop.ErrExpiredBinding) {
+		t.Errorf("Expected error %v, got %v", dpop.ErrExpiredBinding, expiredErr)
+	}
+}
+
+// Test that VerifyBound rejects refresh tokens without a binding
+func TestRefreshTokenBindings_VerifyBound(t *testing.T) {
+	// Arrange
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	underTest := dpop.NewRefreshTokenBindings(dpop.NewMemoryRefreshTokenBindingStore())
+	proof := parseTestRefreshProof(t, key)
+	if err := underTest.Bind(context.Background(), "bound", proof, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	boundErr := underTest.VerifyBound(context.Background(), "bound", proof)
+	unboundErr := underTest.VerifyBound(context.Background(), "unbound", proof)
+
+	// Assert
+	if boundErr != nil {
+		t.Errorf("Unexpected error: %v", boundErr)
+	}
+	if !errors.Is(unboundErr, dpop.ErrMissingBinding) {
+		t.Errorf("Expected error %v, got %v", dpop.ErrMissingBinding, unboundErr)
+	}
+}
+
+// Test that the store never sees raw refresh tokens
+func TestRefreshTokenBindings_HashedTokens(t *testing.T) {
+	// Arrange
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := dpop.NewMemoryRefreshTokenBindingStore()
+	underTest := dpop.NewRefreshTokenBindings(store)
+
+	// Act
+	err = underTest.Bind(context.Background(), "refresh-token", parseTestRefreshProof(t, key), time.Now().Add(time.Hour))
+	raw, rawErr := store.LoadRefreshTokenBinding(context.Background(), "refresh-token")
+	hashed, hashedErr := store.LoadRefreshTokenBinding(context.Background(), dpop.AccessTokenHash("refresh-token"))
+
+	// Assert
+	if err != nil || rawErr != nil || hashedErr != nil {
+		t.Fatalf("Unexpected errors: %v, %v, %v", err, rawErr, hashedErr)
+	}
+	if raw != "" || hashed != testThumbprint(t, key) {
+		t.Errorf("Expected the binding to be stored by token hash, got %q and %q", raw, hashed)
+	}
+}
+
+// Test that a refresh token can not be bound without a proof
+func TestRefreshTokenBindings_BindWithoutProof(t *testing.T) {
+	// Arrange
+	underTest := dpop.NewRefreshTokenBindings(dpop.NewMemoryRefreshTokenBindingStore())
+
+	// Act
+	err := underTest.Bind(context.Background(), "refresh-token", nil, time.Now().Add(time.Hour))
+
+	// Assert
+	if !errors.Is(err, dpop.ErrMissingJWK) {
+		t.Errorf("Expected error %v, got %v", dpop.ErrMissingJWK, err)
+	}
+}
+
+// Test that bindings that expired longer than the retention ago are removed when a binding is saved
+func TestMemoryRefreshTokenBindingStore_Eviction(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	underTest := dpop.NewMemoryRefreshTokenBindingStore()
+	if err := underTest.SaveRefreshTokenBinding(ctx, "evicted", "jkt", time.Now().Add(-2*dpop.EXPIRED_BINDING_RETENTION)); err != nil {
+		t.Fatal(err)
+	}
+	if err := underTest.SaveRefreshTokenBinding(ctx, "retained", "jkt", time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := underTest.SaveRefreshTokenBinding(ctx, "not-expiring", "jkt", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	err := underTest.SaveRefreshTokenBinding(ctx, "new", "jkt", time.Now().Add(time.Hour))
+	_, evictedErr := underTest.LoadRefreshTokenBinding(ctx, "evicted")
+	_, retainedErr := underTest.LoadRefreshTokenBinding(ctx, "retained")
+	notExpiring, notExpiringErr := underTest.LoadRefreshTokenBinding(ctx, "not-expiring")
+
+	// Assert
+	if err != nil || evictedErr != nil || notExpiringErr != nil {
+		t.Errorf("Unexpected errors: %v, %v, %v", err, evictedErr, notExpiringErr)
+	}
+	if notExpiring != "jkt" {
+		t.Errorf("Expected a binding without expiry to be kept, got %q", notExpiring)
+	}
+	if !errors.Is(retainedErr, dpop.ErrExpiredBinding) {
+		t.Errorf("Expected error %v, got %v", dpop.ErrExpiredBinding, retainedErr)
+	}
+}
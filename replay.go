@@ -0,0 +1,122 @@
+package dpop
+
+import (
+	"container/list"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+const DEFAULT_REPLAY_CACHE_SIZE = 100000
+const replayCacheShards = 16
+
+// ReplayCache keeps track of the `jti` claims of proofs that have already been accepted.
+//
+// When set in ParseOptions the Parse function rejects any proof whose `jti` has already been seen for the same public key.
+// This satisfies https://datatracker.ietf.org/doc/html/rfc9449#section-11.1
+type ReplayCache interface {
+	// Seen records the `jti` of a proof signed by the key with thumbprint `jkt`.
+	// It returns true if the `jti` was already recorded and has not yet expired.
+	//
+	// The entry only needs to be retained until expiry, after which the proof would be rejected as expired anyway.
+	Seen(jkt string, jti string, expiry time.Time) bool
+}
+
+// MemoryReplayCache is an in-memory ReplayCache safe for concurrent use.
+//
+// Entries are spread across a number of shards, each of which is an LRU list.
+// When a shard is full, expired entries at the back of the list are evicted first and,
+// if the shard is still full, the least recently used entry is evicted.
+// A proof whose entry is evicted before it expires can be replayed, see NewMemoryReplayCache.
+type MemoryReplayCache struct {
+	shards [replayCacheShards]*replayShard
+}
+
+type replayShard struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	lru      *list.List
+}
+
+type replayEntry struct {
+	key    string
+	expiry time.Time
+}
+
+// NewMemoryReplayCache creates a MemoryReplayCache that holds at most `size` entries.
+//
+// If size is not positive DEFAULT_REPLAY_CACHE_SIZE is used.
+// The size should be large enough to hold all proofs accepted within the allowed proof age,
+// otherwise entries may be evicted before they expire, which allows their proofs to be replayed.
+func NewMemoryReplayCache(size int) *MemoryReplayCache {
+	if size <= 0 {
+		size = DEFAULT_REPLAY_CACHE_SIZE
+	}
+	shardCapacity := size / replayCacheShards
+	if shardCapacity < 1 {
+		shardCapacity = 1
+	}
+
+	c := &MemoryReplayCache{}
+	for i := range c.shards {
+		c.shards[i] = &replayShard{
+			capacity: shardCapacity,
+			entries:  make(map[string]*list.Element),
+			lru:      list.New(),
+		}
+	}
+	return c
+}
+
+// Implement the ReplayCache interface.
+func (c *MemoryReplayCache) Seen(jkt string, jti string, expiry time.Time) bool {
+	key := jkt + "." + jti
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	shard := c.shards[h.Sum32()%replayCacheShards]
+
+	return shard.seen(key, expiry, time.Now())
+}
+
+func (s *replayShard) seen(key string, expiry time.Time, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.entries[key]; ok {
+		entry := element.Value.(*replayEntry)
+		if now.Before(entry.expiry) {
+			s.lru.MoveToFront(element)
+			return true
+		}
+
+		// The previous entry has expired so the `jti` may be accepted again.
+		entry.expiry = expiry
+		s.lru.MoveToFront(element)
+		return false
+	}
+
+	if s.lru.Len() >= s.capacity {
+		s.evict(now)
+	}
+	s.entries[key] = s.lru.PushFront(&replayEntry{key: key, expiry: expiry})
+	return false
+}
+
+// Removes expired entries from the back of the list until an unexpired entry is found
+// and, if the shard is still full, the least recently used entry.
+// Only the back of the list is inspected so that inserting into a full shard does not scan every entry.
+func (s *replayShard) evict(now time.Time) {
+	for element := s.lru.Back(); element != nil && !now.Before(element.Value.(*replayEntry).expiry); element = s.lru.Back() {
+		s.remove(element)
+	}
+
+	for s.lru.Len() >= s.capacity {
+		s.remove(s.lru.Back())
+	}
+}
+
+func (s *replayShard) remove(element *list.Element) {
+	entry := s.lru.Remove(element).(*replayEntry)
+	delete(s.entries, entry.key)
+}
@@ -0,0 +1,158 @@
+package dpop_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/AxisCommunications/go-dpop"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Test that a `jti` is only accepted once for the same key
+func TestMemoryReplayCache_Seen(t *testing.T) {
+	// Arrange
+	underTest := dpop.NewMemoryReplayCache(0)
+	expiry := time.Now().Add(time.Minute)
+
+	// Act & Assert
+	if underTest.Seen("jkt", "jti", expiry) {
+		t.Errorf("Expected first use to not be seen")
+	}
+	if !underTest.Seen("jkt", "jti", expiry) {
+		t.Errorf("Expected second use to be seen")
+	}
+	if underTest.Seen("other", "jti", expiry) {
+		t.Errorf("Expected same jti for other key to not be seen")
+	}
+}
+
+// Test that an expired entry no longer counts as seen
+func TestMemoryReplayCache_Expired(t *testing.T) {
+	// Arrange
+	underTest := dpop.NewMemoryReplayCache(0)
+	underTest.Seen("jkt", "jti", time.Now().Add(-time.Second))
+
+	// Act
+	seen := underTest.Seen("jkt", "jti", time.Now().Add(time.Minute))
+
+	// Assert
+	if seen {
+		t.Errorf("Expected expired entry to not be seen")
+	}
+}
+
+// Test that the cache does not grow beyond its size
+func TestMemoryReplayCache_Eviction(t *testing.T) {
+	// Arrange
+	underTest := dpop.NewMemoryReplayCache(16)
+	expiry := time.Now().Add(time.Minute)
+
+	// Act
+	for i := 0; i < 1000; i++ {
+		underTest.Seen("jkt", fmt.Sprint(i), expiry)
+	}
+
+	// Assert
+	if !underTest.Seen("jkt", "999", expiry) {
+		t.Errorf("Expected most recent entry to be seen")
+	}
+	if underTest.Seen("jkt", "0", expiry) {
+		t.Errorf("Expected oldest entry to be evicted")
+	}
+}
+
+// Test that a replayed proof is rejected by Parse
+func TestParse_ReplayedProof(t *testing.T) {
+	// Arrange
+	httpUrl := url.URL{
+		Scheme: "https",
+		Host:   "server.example.com",
+		Path:   "/token",
+	}
+	duration := time.Duration(438000) * time.Hour
+	opts := dpop.ParseOptions{
+		AllowedProofAge: &duration,
+		ReplayCache:     dpop.NewMemoryReplayCache(0),
+	}
+
+	// Act
+	_, err := dpop.Parse(validES256_proof, dpop.POST, &httpUrl, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	proof, err := dpop.Parse(validES256_proof, dpop.POST, &httpUrl, opts)
+
+	// Assert
+	if err == nil {
+		t.Errorf("Expected error")
+	}
+	if err != nil {
+		AssertJoinedError(t, err, dpop.ErrReplayed)
+	}
+	if proof != nil {
+		t.Errorf("Expected nil token")
+	}
+}
+
+// A replay cache that records the expiry of the entries it is asked to keep.
+type recordingReplayCache struct {
+	expiry time.Time
+}
+
+func (c *recordingReplayCache) Seen(jkt string, jti string, expiry time.Time) bool {
+	c.expiry = expiry
+	return false
+}
+
+// Test that the `jti` of a proof with a server nonce is kept for as long as the nonce is valid
+func TestParse_ReplayCacheNonceLifetime(t *testing.T) {
+	// Arrange
+	lifetime := time.Hour
+	issuer, err := dpop.NewNonceIssuer([][]byte{nonceKeyA}, dpop.NonceOptions{Lifetime: &lifetime})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	nonce, err := issuer.Issue()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	proofString, err := dpop.Create(jwt.SigningMethodES256, &dpop.ProofTokenClaims{
+		RegisteredClaims: &jwt.RegisteredClaims{
+			ID:       "id",
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+		Method: dpop.POST,
+		URL:    "https://server.example.com/token",
+		Nonce:  nonce,
+	}, privateKey)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	replayCache := &recordingReplayCache{}
+	opts := dpop.ParseOptions{
+		NonceVerifier:     issuer,
+		NonceHasTimestamp: true,
+		ReplayCache:       replayCache,
+	}
+	start := time.Now()
+
+	// Act
+	_, err = dpop.Parse(proofString, dpop.POST, &url.URL{Scheme: "https", Host: "server.example.com", Path: "/token"}, opts)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if replayCache.expiry.Before(start.Add(lifetime)) {
+		t.Errorf("Expected the jti to be kept for the nonce lifetime, got expiry %v", replayCache.expiry)
+	}
+}
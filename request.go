@@ -0,0 +1,103 @@
+package dpop
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ParseRequest reads the `DPoP` header of an incoming request and parses it with the Parse function.
+//
+// The HTTP method, scheme, host and path used to check the `htm` and `htu` claims are derived from the request.
+// The scheme and host are read from forwarded headers if they are listed in ParseOptions.TrustedForwardedHeaders.
+//
+// It also satisfies point 1 in https://datatracker.ietf.org/doc/html/rfc9449#section-4.3
+// by ensuring that the request has exactly one `DPoP` header.
+func ParseRequest(r *http.Request, opts ParseOptions) (*Proof, error) {
+	proofStrings := r.Header.Values("DPoP")
+	if len(proofStrings) == 0 {
+		return nil, errors.Join(ErrInvalidProof, ErrMissingProof)
+	}
+	if len(proofStrings) > 1 {
+		return nil, errors.Join(ErrInvalidProof, ErrMultipleProofs)
+	}
+
+	return Parse(proofStrings[0], HTTPVerb(r.Method), RequestURL(r, opts.TrustedForwardedHeaders), opts)
+}
+
+// RequestURL derives the URL that a client targeted with the request, without query and fragment.
+//
+// The scheme and host are read from the forwarded headers listed in trustedForwardedHeaders, if present.
+// Supported headers are "Forwarded", "X-Forwarded-Proto" and "X-Forwarded-Host".
+// Proxies append to these headers, so only the last element, added by the trusted proxy in front of the server, is used.
+// Earlier elements are controlled by the client.
+func RequestURL(r *http.Request, trustedForwardedHeaders []string) *url.URL {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Host
+
+	for _, header := range trustedForwardedHeaders {
+		switch http.CanonicalHeaderKey(header) {
+		case "Forwarded":
+			forwardedProto, forwardedHost := parseForwarded(headerListValue(r, "Forwarded"))
+			if forwardedProto != "" {
+				scheme = forwardedProto
+			}
+			if forwardedHost != "" {
+				host = forwardedHost
+			}
+		case "X-Forwarded-Proto":
+			if forwardedProto := lastListElement(headerListValue(r, "X-Forwarded-Proto")); forwardedProto != "" {
+				scheme = forwardedProto
+			}
+		case "X-Forwarded-Host":
+			if forwardedHost := lastListElement(headerListValue(r, "X-Forwarded-Host")); forwardedHost != "" {
+				host = forwardedHost
+			}
+		}
+	}
+
+	return &url.URL{
+		Scheme:  scheme,
+		Host:    host,
+		Path:    r.URL.Path,
+		RawPath: r.URL.RawPath,
+	}
+}
+
+// Reads the `proto` and `host` parameters of the last element of a `Forwarded` header.
+// See https://datatracker.ietf.org/doc/html/rfc7239#section-4
+func parseForwarded(value string) (proto string, host string) {
+	for _, pair := range strings.Split(lastListElement(value), ";") {
+		key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		val = strings.Trim(val, "\"")
+		switch strings.ToLower(key) {
+		case "proto":
+			proto = val
+		case "host":
+			host = val
+		}
+	}
+	return proto, host
+}
+
+// Returns all lines of a header as a single comma separated list.
+// See https://datatracker.ietf.org/doc/html/rfc9110#section-5.3
+func headerListValue(r *http.Request, header string) string {
+	return strings.Join(r.Header.Values(header), ",")
+}
+
+// Returns the last element of a comma separated header value.
+// The last element is set by the proxy closest to the server.
+func lastListElement(value string) string {
+	if i := strings.LastIndex(value, ","); i >= 0 {
+		value = value[i+1:]
+	}
+	return strings.TrimSpace(value)
+}
@@ -0,0 +1,161 @@
+package dpop_test
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/AxisCommunications/go-dpop"
+)
+
+// Test that a proof is parsed from a request
+func TestParseRequest(t *testing.T) {
+	// Arrange
+	r := httptest.NewRequest("POST", "https://server.example.com/token?query=true", nil)
+	r.Header.Set("DPoP", validES256_proof)
+	duration := time.Duration(438000) * time.Hour
+
+	// Act
+	proof, err := dpop.ParseRequest(r, dpop.ParseOptions{AllowedProofAge: &duration})
+
+	// Assert
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if proof == nil || proof.Valid != true {
+		t.Errorf("Expected token to be valid")
+	}
+	if r.URL.RawQuery != "query=true" {
+		t.Errorf("Expected request URL to be unmodified")
+	}
+}
+
+// Test that trusted forwarded headers are used to derive the request URL
+func TestParseRequest_TrustedForwardedHeaders(t *testing.T) {
+	testCases := map[string]map[string]string{
+		"Forwarded": {
+			"Forwarded": "for=198.51.100.17;proto=http;host=\"attacker.example.com\", for=192.0.2.60;proto=https;host=\"server.example.com\"",
+		},
+		"X-Forwarded-Proto": {
+			"X-Forwarded-Proto": "https",
+			"X-Forwarded-Host":  "attacker.example.com, server.example.com",
+		},
+	}
+
+	for name, headers := range testCases {
+		t.Run(name, func(t *testing.T) {
+			// Arrange
+			r := httptest.NewRequest("POST", "http://internal:8080/token", nil)
+			r.Header.Set("DPoP", validES256_proof)
+			for key, value := range headers {
+				r.Header.Set(key, value)
+			}
+			duration := time.Duration(438000) * time.Hour
+
+			// Act
+			proof, err := dpop.ParseRequest(r, dpop.ParseOptions{
+				AllowedProofAge:         &duration,
+				TrustedForwardedHeaders: []string{"forwarded", "X-Forwarded-Proto", "X-Forwarded-Host"},
+			})
+
+			// Assert
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if proof == nil || proof.Valid != true {
+				t.Errorf("Expected token to be valid")
+			}
+		})
+	}
+}
+
+// Test that elements of forwarded headers added before the trusted proxy can not select the host
+func TestRequestURL_SpoofedForwardedHeaders(t *testing.T) {
+	// Arrange
+	r := httptest.NewRequest("POST", "http://internal:8080/token", nil)
+	r.Header.Add("X-Forwarded-Host", "attacker.example.com")
+	r.Header.Add("X-Forwarded-Host", "server.example.com")
+	r.Header.Add("Forwarded", "proto=http;host=attacker.example.com")
+	r.Header.Add("Forwarded", "proto=https")
+
+	// Act
+	u := dpop.RequestURL(r, []string{"Forwarded", "X-Forwarded-Host"})
+
+	// Assert
+	if u.String() != "https://server.example.com/token" {
+		t.Errorf("Expected URL from the last forwarded elements, got %s", u)
+	}
+}
+
+// Test that forwarded headers are ignored unless trusted
+func TestParseRequest_UntrustedForwardedHeaders(t *testing.T) {
+	// Arrange
+	r := httptest.NewRequest("POST", "http://internal:8080/token", nil)
+	r.Header.Set("DPoP", validES256_proof)
+	r.Header.Set("X-Forwarded-Proto", "https")
+	r.Header.Set("X-Forwarded-Host", "server.example.com")
+	duration := time.Duration(438000) * time.Hour
+
+	// Act
+	proof, err := dpop.ParseRequest(r, dpop.ParseOptions{AllowedProofAge: &duration})
+
+	// Assert
+	if err == nil {
+		t.Errorf("Expected error")
+	}
+	if err != nil {
+		AssertJoinedError(t, err, dpop.ErrIncorrectHTTPTarget)
+	}
+	if proof != nil {
+		t.Errorf("Expected nil token")
+	}
+}
+
+// Test that a request without exactly one `DPoP` header is rejected
+func TestParseRequest_ProofHeaderCount(t *testing.T) {
+	// Arrange
+	missing := httptest.NewRequest("POST", "https://server.example.com/token", nil)
+	multiple := httptest.NewRequest("POST", "https://server.example.com/token", nil)
+	multiple.Header.Add("DPoP", validES256_proof)
+	multiple.Header.Add("DPoP", validES256_proof)
+
+	// Act
+	_, missingErr := dpop.ParseRequest(missing, dpop.ParseOptions{})
+	_, multipleErr := dpop.ParseRequest(multiple, dpop.ParseOptions{})
+
+	// Assert
+	AssertJoinedError(t, missingErr, dpop.ErrMissingProof)
+	AssertJoinedError(t, multipleErr, dpop.ErrMultipleProofs)
+}
+
+// Test that Parse does not modify the supplied URL
+func TestParse_DoesNotModifyURL(t *testing.T) {
+	// Arrange
+	httpUrl, err := url.Parse("https://server.example.com/token?query=true#fragment")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	duration := time.Duration(438000) * time.Hour
+
+	// Act
+	_, err = dpop.Parse(validES256_proof, dpop.POST, httpUrl, dpop.ParseOptions{AllowedProofAge: &duration})
+
+	// Assert
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if httpUrl.String() != "https://server.example.com/token?query=true#fragment" {
+		t.Errorf("Expected URL to be unmodified, got %v", httpUrl)
+	}
+}
+
+// Helper function to parse a URL in tests.
+func mustParseURL(t *testing.T, rawURL string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return u
+}
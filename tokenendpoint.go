@@ -0,0 +1,235 @@
+package dpop
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Error codes of token endpoint responses. See https://datatracker.ietf.org/doc/html/rfc6749#section-5.2
+const (
+	ErrorCodeInvalidClient        = "invalid_client"
+	ErrorCodeInvalidGrant         = "invalid_grant"
+	ErrorCodeUnauthorizedClient   = "unauthorized_client"
+	ErrorCodeUnsupportedGrantType = "unsupported_grant_type"
+	ErrorCodeInvalidScope         = "invalid_scope"
+)
+
+// TokenResponse is a successful response of a token endpoint. See https://datatracker.ietf.org/doc/html/rfc6749#section-5.1
+//
+// The token type is always set to `DPoP` by TokenEndpoint. See https://datatracker.ietf.org/doc/html/rfc9449#section-5
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+
+	// The lifetime in seconds of the refresh token, for which TokenEndpoint binds it. It is not sent in the response.
+	// If not set the refresh token is bound until the binding is revoked.
+	RefreshTokenExpiresIn int64 `json:"-"`
+}
+
+// TokenError is an error that a GrantHandler returns to reject a token request with an OAuth error code.
+// See https://datatracker.ietf.org/doc/html/rfc6749#section-5.2
+type TokenError struct {
+	// The error code, such as ErrorCodeInvalidGrant.
+	Code string
+
+	// An optional human readable description of the error.
+	Description string
+
+	// The HTTP status code of the response. If not set 400 is used.
+	Status int
+}
+
+func (e *TokenError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+// GrantHandler processes token requests after the proof of the request has been verified.
+type GrantHandler interface {
+	// HandleGrant authenticates the client, validates the grant and issues a token bound to the key of the proof.
+	// The form of the request has already been parsed.
+	//
+	// Return a *TokenError to reject the request with an OAuth error code.
+	// Errors returned by Parse or Proof.Validate are turned into DPoP error responses,
+	// any other error is reported as a `server_error`.
+	HandleGrant(r *http.Request, proof *Proof) (*TokenResponse, error)
+}
+
+// GrantHandlerFunc allows an ordinary function to be used as a GrantHandler.
+type GrantHandlerFunc func(r *http.Request, proof *Proof) (*TokenResponse, error)
+
+// Implement the GrantHandler interface.
+func (f GrantHandlerFunc) HandleGrant(r *http.Request, proof *Proof) (*TokenResponse, error) {
+	return f(r, proof)
+}
+
+// TokenEndpoint is a http.Handler for a token endpoint issuing DPoP bound tokens.
+// See https://datatracker.ietf.org/doc/html/rfc9449#section-5
+//
+// It parses the proof of the request with ParseRequest, requires a server nonce if a NonceIssuer is set,
+// checks that authorization codes bound with `dpop_jkt` and bound refresh tokens are used with the bound key
+// and delegates the grant to a GrantHandler. Rejected requests get a JSON error body.
+type TokenEndpoint struct {
+	// Processes the grant of a request. Required.
+	Grants GrantHandler
+
+	// Options used when parsing the proof of a request.
+	ParseOptions ParseOptions
+
+	// Used to issue and verify server nonces. If set it is used as ParseOptions.NonceVerifier
+	// and a new nonce is sent in the `DPoP-Nonce` header when a request is rejected because of its nonce.
+	NonceIssuer *NonceIssuer
+
+	// The `dpop_jkt` bindings of authorization codes. If set, every authorization code must have been saved
+	// in the store when it was issued, with an empty `dpop_jkt` if it was not bound, and bound codes must be redeemed
+	// with a proof signed by the key they were bound to. See https://datatracker.ietf.org/doc/html/rfc9449#section-10
+	CodeBindings CodeBindingStore
+
+	// The bindings of refresh tokens. If set, refresh tokens in the responses of the GrantHandler are bound
+	// to the key of the proof, and refresh tokens can only be used with a proof signed by the key they are bound to.
+	// Refresh tokens without a binding are rejected, see RefreshTokenBindings.VerifyBound.
+	// See https://datatracker.ietf.org/doc/html/rfc9449#section-5
+	RefreshTokenBindings *RefreshTokenBindings
+
+	// If set, refresh tokens without a binding are accepted, see RefreshTokenBindings.Verify.
+	// This allows refresh tokens issued before RefreshTokenBindings was set to be used,
+	// but also refresh tokens whose bindings have been removed from the store.
+	AllowUnboundRefreshTokens bool
+}
+
+// Implement the http.Handler interface.
+func (e *TokenEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		e.writeError(w, errors.Join(ErrInvalidRequest, err))
+		return
+	}
+
+	parseOptions := e.ParseOptions
+	if e.NonceIssuer != nil {
+		parseOptions.NonceVerifier = e.NonceIssuer
+	}
+	proof, err := ParseRequest(r, parseOptions)
+	if err != nil {
+		e.writeError(w, err)
+		return
+	}
+
+	// The binding of a code is only removed once the grant has succeeded, so that a rejected request
+	// can not leave the code unbound for a later request signed with another key.
+	// Codes without a stored binding, including codes whose binding has been removed, are rejected.
+	redeemedCode := ""
+	if e.CodeBindings != nil && r.PostForm.Get("grant_type") == "authorization_code" {
+		code := r.PostForm.Get("code")
+		jkt, err := e.CodeBindings.LoadCodeBinding(r.Context(), code)
+		if err != nil {
+			e.writeError(w, err)
+			return
+		}
+		if jkt != "" && !constantTimeEqual(jkt, proof.PublicKey()) {
+			e.writeError(w, errors.Join(ErrInvalidProof, ErrIncorrectJKT))
+			return
+		}
+		redeemedCode = code
+	}
+
+	if e.RefreshTokenBindings != nil && r.PostForm.Get("grant_type") == "refresh_token" {
+		verify := e.RefreshTokenBindings.VerifyBound
+		if e.AllowUnboundRefreshTokens {
+			verify = e.RefreshTokenBindings.Verify
+		}
+		if err := verify(r.Context(), r.PostForm.Get("refresh_token"), proof); err != nil {
+			e.writeError(w, err)
+			return
+		}
+	}
+
+	if e.Grants == nil {
+		e.writeError(w, errors.New("missing grant handler"))
+		return
+	}
+	response, err := e.Grants.HandleGrant(r, proof)
+	if err != nil {
+		e.writeError(w, err)
+		return
+	}
+	if response == nil {
+		e.writeError(w, errors.New("grant handler returned no response"))
+		return
+	}
+
+	if e.RefreshTokenBindings != nil && response.RefreshToken != "" {
+		expiry := time.Time{}
+		if response.RefreshTokenExpiresIn > 0 {
+			expiry = time.Now().Add(time.Duration(response.RefreshTokenExpiresIn) * time.Second)
+		}
+		// A refresh token that could not be bound is not issued.
+		if err := e.RefreshTokenBindings.Bind(r.Context(), response.RefreshToken, proof, expiry); err != nil {
+			e.writeError(w, err)
+			return
+		}
+	}
+
+	if redeemedCode != "" {
+		// The code has been redeemed, a binding that can not be removed remains until it expires.
+		_ = e.CodeBindings.DeleteCodeBinding(r.Context(), redeemedCode)
+	}
+
+	response.TokenType = TokenTypeDPoP
+	// Marshalling a struct of strings and integers can not fail.
+	body, _ := json.Marshal(response)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
+
+// Writes the error response of a rejected token request.
+func (e *TokenEndpoint) writeError(w http.ResponseWriter, err error) {
+	var tokenError *TokenError
+	switch {
+	case errors.As(err, &tokenError):
+		status := tokenError.Status
+		if status == 0 {
+			status = http.StatusBadRequest
+		}
+		writeTokenError(w, status, tokenError.Code, tokenError.Description)
+	case errors.Is(err, ErrExpiredBinding), errors.Is(err, ErrMissingBinding):
+		writeTokenError(w, http.StatusBadRequest, ErrorCodeInvalidGrant, "the key binding of the grant is missing or has expired")
+	case errors.Is(err, ErrInvalidProof), errors.Is(err, ErrIncorrectNonce), errors.Is(err, ErrInvalidRequest):
+		responseOptions := ErrorResponseOptions{AllowedAlgorithms: e.ParseOptions.AllowedAlgorithms, TokenEndpoint: true}
+		if e.NonceIssuer != nil && ErrorCode(err) == ErrorCodeUseDPoPNonce {
+			if nonce, err := e.NonceIssuer.Issue(); err == nil {
+				responseOptions.Nonce = nonce
+			}
+		}
+		WriteError(w, err, responseOptions)
+	default:
+		writeTokenError(w, http.StatusInternalServerError, ErrorCodeServerError, "")
+	}
+}
+
+// Writes a JSON error body. See https://datatracker.ietf.org/doc/html/rfc6749#section-5.2
+func writeTokenError(w http.ResponseWriter, status int, code string, description string) {
+	errorBody := map[string]string{"error": code}
+	if description != "" {
+		errorBody["error_description"] = description
+	}
+	// Marshalling a map of strings can not fail.
+	body, _ := json.Marshal(errorBody)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
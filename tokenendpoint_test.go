@@ -0,0 +1,472 @@
+package dpop_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AxisCommunications/go-dpop"
+)
+
+const testTokenURL = "https://server.example.com/token"
+
+// Helper function to create a token request with a proof signed by the supplied key.
+func newTestTokenRequest(t *testing.T, key *ecdsa.PrivateKey, form url.Values, nonce string) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, testTokenURL, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if key != nil {
+		req.Header.Set("DPoP", createTestProof(t, key, dpop.POST, testTokenURL, "", nonce))
+	}
+	return req
+}
+
+// Helper function to read the JSON body of a token endpoint response.
+func readTestTokenResponse(t *testing.T, rec *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	body := map[string]interface{}{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Unexpected body %q: %v", rec.Body.String(), err)
+	}
+	return body
+}
+
+// A grant handler that issues access tokens bound to the proof for the client credentials grant.
+func newTestGrantHandler(t *testing.T) dpop.GrantHandler {
+	t.Helper()
+	serverKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := dpop.NewAccessTokenIssuer("https://server.example.com", serverKey, dpop.AccessTokenIssuerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dpop.GrantHandlerFunc(func(r *http.Request, proof *dpop.Proof) (*dpop.TokenResponse, error) {
+		switch r.PostForm.Get("grant_type") {
+		case "client_credentials", "authorization_code", "refresh_token":
+		default:
+			return nil, &dpop.TokenError{Code: dpop.ErrorCodeUnsupportedGrantType}
+		}
+		accessToken, claims, err := issuer.Issue(proof, dpop.AccessTokenRequest{
+			Subject:  "client",
+			ClientID: "client",
+			Audience: []string{"https://resource.example.com"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &dpop.TokenResponse{
+			AccessToken: accessToken,
+			ExpiresIn:   int64(time.Until(claims.ExpiresAt.Time).Seconds()),
+		}, nil
+	})
+}
+
+// Test that a token request with a valid proof gets a DPoP bound access token
+func TestTokenEndpoint_Success(t *testing.T) {
+	// Arrange
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	underTest := &dpop.TokenEndpoint{Grants: newTestGrantHandler(t)}
+	rec := httptest.NewRecorder()
+
+	// Act
+	underTest.ServeHTTP(rec, newTestTokenRequest(t, key, url.Values{"grant_type": {"client_credentials"}}, ""))
+
+	// Assert
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Cache-Control") != "no-store" || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Unexpected headers %v", rec.Header())
+	}
+	body := readTestTokenResponse(t, rec)
+	if body["token_type"] != "DPoP" || body["access_token"] == "" || body["expires_in"] == nil {
+		t.Errorf("Unexpected body %v", body)
+	}
+}
+
+// Test that rejected token requests get JSON error bodies
+func TestTokenEndpoint_Errors(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name           string
+		key            *ecdsa.PrivateKey
+		form           url.Values
+		grants         dpop.GrantHandler
+		expectedStatus int
+		expectedError  string
+	}{
+		{name: "missing proof", key: nil, form: url.Values{"grant_type": {"client_credentials"}}, grants: newTestGrantHandler(t), expectedStatus: http.StatusBadRequest, expectedError: dpop.ErrorCodeInvalidDPoPProof},
+		{name: "unsupported grant", key: key, form: url.Values{"grant_type": {"password"}}, grants: newTestGrantHandler(t), expectedStatus: http.StatusBadRequest, expectedError: dpop.ErrorCodeUnsupportedGrantType},
+		{
+			name: "invalid client",
+			key:  key,
+			form: url.Values{"grant_type": {"client_credentials"}},
+			grants: dpop.GrantHandlerFunc(func(r *http.Request, proof *dpop.Proof) (*dpop.TokenResponse, error) {
+				return nil, &dpop.TokenError{Code: dpop.ErrorCodeInvalidClient, Status: http.StatusUnauthorized}
+			}),
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  dpop.ErrorCodeInvalidClient,
+		},
+		{
+			name: "server error",
+			key:  key,
+			form: url.Values{"grant_type": {"client_credentials"}},
+			grants: dpop.GrantHandlerFunc(func(r *http.Request, proof *dpop.Proof) (*dpop.TokenResponse, error) {
+				return nil, errors.New("database is down")
+			}),
+			expectedStatus: http.StatusInternalServerError,
+			expectedError:  dpop.ErrorCodeServerError,
+		},
+		{
+			name: "no response",
+			key:  key,
+			form: url.Values{"grant_type": {"client_credentials"}},
+			grants: dpop.GrantHandlerFunc(func(r *http.Request, proof *dpop.Proof) (*dpop.TokenResponse, error) {
+				return nil, nil
+			}),
+			expectedStatus: http.StatusInternalServerError,
+			expectedError:  dpop.ErrorCodeServerError,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			// Arrange
+			underTest := &dpop.TokenEndpoint{Grants: testCase.grants}
+			rec := httptest.NewRecorder()
+
+			// Act
+			underTest.ServeHTTP(rec, newTestTokenRequest(t, testCase.key, testCase.form, ""))
+
+			// Assert
+			if rec.Code != testCase.expectedStatus {
+				t.Errorf("Expected status %d, got %d", testCase.expectedStatus, rec.Code)
+			}
+			body := readTestTokenResponse(t, rec)
+			if body["error"] != testCase.expectedError {
+				t.Errorf("Expected error %s, got %v", testCase.expectedError, body)
+			}
+			if strings.Contains(rec.Body.String(), "database") {
+				t.Errorf("Expected internal errors to not be exposed")
+			}
+		})
+	}
+}
+
+// Test that only POST requests are accepted
+func TestTokenEndpoint_MethodNotAllowed(t *testing.T) {
+	// Arrange
+	underTest := &dpop.TokenEndpoint{Grants: newTestGrantHandler(t)}
+	rec := httptest.NewRecorder()
+
+	// Act
+	underTest.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, testTokenURL, nil))
+
+	// Assert
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != http.MethodPost {
+		t.Errorf("Expected status 405, got %d", rec.Code)
+	}
+}
+
+// Test that a token request without a server nonce is rejected with a new nonce that is then accepted
+func TestTokenEndpoint_Nonce(t *testing.T) {
+	// Arrange
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonceIssuer, err := dpop.NewNonceIssuer([][]byte{nonceKeyA}, dpop.NonceOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	underTest := &dpop.TokenEndpoint{Grants: newTestGrantHandler(t), NonceIssuer: nonceIssuer}
+	form := url.Values{"grant_type": {"client_credentials"}}
+
+	// Act
+	rejected := httptest.NewRecorder()
+	underTest.ServeHTTP(rejected, newTestTokenRequest(t, key, form, ""))
+	nonce := rejected.Header().Get("DPoP-Nonce")
+	accepted := httptest.NewRecorder()
+	underTest.ServeHTTP(accepted, newTestTokenRequest(t, key, form, nonce))
+
+	// Assert
+	if rejected.Code != http.StatusBadRequest || readTestTokenResponse(t, rejected)["error"] != dpop.ErrorCodeUseDPoPNonce {
+		t.Errorf("Expected use_dpop_nonce error, got %d: %s", rejected.Code, rejected.Body.String())
+	}
+	if nonce == "" {
+		t.Fatalf("Expected a new nonce")
+	}
+	if accepted.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d: %s", accepted.Code, accepted.Body.String())
+	}
+}
+
+// Test that an authorization code bound with `dpop_jkt` can only be redeemed with the bound key
+func TestTokenEndpoint_CodeBinding(t *testing.T) {
+	// Arrange
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jkt, err := dpop.JKT(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bindings := dpop.NewMemoryCodeBindingStore()
+	if err := bindings.SaveCodeBinding(context.Background(), "code", jkt, time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	underTest := &dpop.TokenEndpoint{Grants: newTestGrantHandler(t), CodeBindings: bindings}
+	form := url.Values{"grant_type": {"authorization_code"}, "code": {"code"}}
+
+	// Act
+	rejected := httptest.NewRecorder()
+	underTest.ServeHTTP(rejected, newTestTokenRequest(t, otherKey, form, ""))
+	rejectedAgain := httptest.NewRecorder()
+	underTest.ServeHTTP(rejectedAgain, newTestTokenRequest(t, otherKey, form, ""))
+	accepted := httptest.NewRecorder()
+	underTest.ServeHTTP(accepted, newTestTokenRequest(t, key, form, ""))
+	remaining, err := bindings.LoadCodeBinding(context.Background(), "code")
+
+	// Assert
+	for _, rec := range []*httptest.ResponseRecorder{rejected, rejectedAgain} {
+		if rec.Code != http.StatusBadRequest || readTestTokenResponse(t, rec)["error"] != dpop.ErrorCodeInvalidDPoPProof {
+			t.Errorf("Expected invalid_dpop_proof error, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+	if accepted.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d: %s", accepted.Code, accepted.Body.String())
+	}
+	if remaining != "" || !errors.Is(err, dpop.ErrMissingBinding) {
+		t.Errorf("Expected binding to be removed after the code was redeemed, got %q: %v", remaining, err)
+	}
+}
+
+// Test that an authorization code with an expired binding is rejected
+func TestTokenEndpoint_ExpiredCodeBinding(t *testing.T) {
+	// Arrange
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jkt, err := dpop.JKT(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bindings := dpop.NewMemoryCodeBindingStore()
+	if err := bindings.SaveCodeBinding(context.Background(), "code", jkt, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	underTest := &dpop.TokenEndpoint{Grants: newTestGrantHandler(t), CodeBindings: bindings}
+	rec := httptest.NewRecorder()
+
+	// Act
+	underTest.ServeHTTP(rec, newTestTokenRequest(t, key, url.Values{"grant_type": {"authorization_code"}, "code": {"code"}}, ""))
+
+	// Assert
+	if rec.Code != http.StatusBadRequest || readTestTokenResponse(t, rec)["error"] != dpop.ErrorCodeInvalidGrant {
+		t.Errorf("Expected invalid_grant error, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+// Test that codes issued without `dpop_jkt` are accepted once and codes without a stored binding are rejected
+func TestTokenEndpoint_UnboundCode(t *testing.T) {
+	// Arrange
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bindings := dpop.NewMemoryCodeBindingStore()
+	if err := bindings.SaveCodeBinding(context.Background(), "unbound", "", time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := bindings.SaveCodeBinding(context.Background(), "purged", "jkt", time.Now().Add(-2*dpop.EXPIRED_BINDING_RETENTION)); err != nil {
+		t.Fatal(err)
+	}
+	// Saving another binding purges the expired binding.
+	if err := bindings.SaveCodeBinding(context.Background(), "other", "", time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	underTest := &dpop.TokenEndpoint{Grants: newTestGrantHandler(t), CodeBindings: bindings}
+	unbound := url.Values{"grant_type": {"authorization_code"}, "code": {"unbound"}}
+
+	// Act
+	accepted := httptest.NewRecorder()
+	underTest.ServeHTTP(accepted, newTestTokenRequest(t, key, unbound, ""))
+	redeemed := httptest.NewRecorder()
+	underTest.ServeHTTP(redeemed, newTestTokenRequest(t, key, unbound, ""))
+	purged := httptest.NewRecorder()
+	underTest.ServeHTTP(purged, newTestTokenRequest(t, key, url.Values{"grant_type": {"authorization_code"}, "code": {"purged"}}, ""))
+
+	// Assert
+	if accepted.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d: %s", accepted.Code, accepted.Body.String())
+	}
+	for _, rec := range []*httptest.ResponseRecorder{redeemed, purged} {
+		if rec.Code != http.StatusBadRequest || readTestTokenResponse(t, rec)["error"] != dpop.ErrorCodeInvalidGrant {
+			t.Errorf("Expected invalid_grant error, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+}
+
+// Test that a bound refresh token can only be used with the bound key
+func TestTokenEndpoint_RefreshTokenBinding(t *testing.T) {
+	// Arrange
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bindings := dpop.NewRefreshTokenBindings(dpop.NewMemoryRefreshTokenBindingStore())
+	if err := bindings.Bind(context.Background(), "refresh-token", parseTestRefreshProof(t, key), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	underTest := &dpop.TokenEndpoint{Grants: newTestGrantHandler(t), RefreshTokenBindings: bindings}
+	form := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {"refresh-token"}}
+
+	// Act
+	rejected := httptest.NewRecorder()
+	underTest.ServeHTTP(rejected, newTestTokenRequest(t, otherKey, form, ""))
+	accepted := httptest.NewRecorder()
+	underTest.ServeHTTP(accepted, newTestTokenRequest(t, key, form, ""))
+
+	// Assert
+	if rejected.Code != http.StatusBadRequest || readTestTokenResponse(t, rejected)["error"] != dpop.ErrorCodeInvalidDPoPProof {
+		t.Errorf("Expected invalid_dpop_proof error, got %d: %s", rejected.Code, rejected.Body.String())
+	}
+	if accepted.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d: %s", accepted.Code, accepted.Body.String())
+	}
+}
+
+// Test that refresh tokens without a binding are rejected unless unbound refresh tokens are allowed
+func TestTokenEndpoint_UnboundRefreshToken(t *testing.T) {
+	// Arrange
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	underTest := &dpop.TokenEndpoint{
+		Grants:               newTestGrantHandler(t),
+		RefreshTokenBindings: dpop.NewRefreshTokenBindings(dpop.NewMemoryRefreshTokenBindingStore()),
+	}
+	form := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {"unbound"}}
+
+	// Act
+	rejected := httptest.NewRecorder()
+	underTest.ServeHTTP(rejected, newTestTokenRequest(t, key, form, ""))
+	underTest.AllowUnboundRefreshTokens = true
+	accepted := httptest.NewRecorder()
+	underTest.ServeHTTP(accepted, newTestTokenRequest(t, key, form, ""))
+
+	// Assert
+	if rejected.Code != http.StatusBadRequest || readTestTokenResponse(t, rejected)["error"] != dpop.ErrorCodeInvalidGrant {
+		t.Errorf("Expected invalid_grant error, got %d: %s", rejected.Code, rejected.Body.String())
+	}
+	if accepted.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d: %s", accepted.Code, accepted.Body.String())
+	}
+}
+
+// Test that refresh tokens issued by the grant handler are bound to the key of the proof
+func TestTokenEndpoint_BindsIssuedRefreshTokens(t *testing.T) {
+	// Arrange
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grants := newTestGrantHandler(t)
+	underTest := &dpop.TokenEndpoint{
+		Grants: dpop.GrantHandlerFunc(func(r *http.Request, proof *dpop.Proof) (*dpop.TokenResponse, error) {
+			response, err := grants.HandleGrant(r, proof)
+			if err != nil {
+				return nil, err
+			}
+			response.RefreshToken = "issued-refresh-token"
+			return response, nil
+		}),
+		RefreshTokenBindings: dpop.NewRefreshTokenBindings(dpop.NewMemoryRefreshTokenBindingStore()),
+	}
+	issued := httptest.NewRecorder()
+	underTest.ServeHTTP(issued, newTestTokenRequest(t, key, url.Values{"grant_type": {"client_credentials"}}, ""))
+	if issued.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", issued.Code, issued.Body.String())
+	}
+	form := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {"issued-refresh-token"}}
+
+	// Act
+	rejected := httptest.NewRecorder()
+	underTest.ServeHTTP(rejected, newTestTokenRequest(t, otherKey, form, ""))
+	accepted := httptest.NewRecorder()
+	underTest.ServeHTTP(accepted, newTestTokenRequest(t, key, form, ""))
+
+	// Assert
+	if rejected.Code != http.StatusBadRequest || readTestTokenResponse(t, rejected)["error"] != dpop.ErrorCodeInvalidDPoPProof {
+		t.Errorf("Expected invalid_dpop_proof error, got %d: %s", rejected.Code, rejected.Body.String())
+	}
+	if accepted.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d: %s", accepted.Code, accepted.Body.String())
+	}
+}
+
+// Test that a refresh token whose binding has been removed from the store can not be used with another key
+func TestTokenEndpoint_PurgedRefreshTokenBinding(t *testing.T) {
+	// Arrange
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bindings := dpop.NewRefreshTokenBindings(dpop.NewMemoryRefreshTokenBindingStore())
+	expired := time.Now().Add(-2 * dpop.EXPIRED_BINDING_RETENTION)
+	if err := bindings.Bind(context.Background(), "refresh-token", parseTestRefreshProof(t, key), expired); err != nil {
+		t.Fatal(err)
+	}
+	// Saving another binding purges the expired binding.
+	if err := bindings.Bind(context.Background(), "other-refresh-token", parseTestRefreshProof(t, key), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	underTest := &dpop.TokenEndpoint{Grants: newTestGrantHandler(t), RefreshTokenBindings: bindings}
+	rec := httptest.NewRecorder()
+
+	// Act
+	underTest.ServeHTTP(rec, newTestTokenRequest(t, otherKey, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {"refresh-token"}}, ""))
+
+	// Assert
+	if rec.Code != http.StatusBadRequest || readTestTokenResponse(t, rec)["error"] != dpop.ErrorCodeInvalidGrant {
+		t.Errorf("Expected invalid_grant error, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,186 @@
+package dpop
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// The maximum size of an error body that is read to look for a `use_dpop_nonce` error.
+const maxErrorBodySize = 1 << 16
+
+// Transport is a http.RoundTripper that attaches a new DPoP proof to every request it sends.
+//
+// The `htm` and `htu` claims are taken from the outgoing request and
+// if the request has a `DPoP` access token in the `Authorization` header the proof is bound to it with the `ath` claim.
+//
+// Nonces received in the `DPoP-Nonce` header of responses are remembered per origin and included in later proofs.
+// If a server rejects a request with a `use_dpop_nonce` error the request is signed with the new nonce and retried once.
+// See https://datatracker.ietf.org/doc/html/rfc9449#section-8
+type Transport struct {
+	// The private key used to sign proofs.
+	Key crypto.Signer
+
+	// The method used to sign proofs. If not set it is chosen from the type of the key.
+	SigningMethod jwt.SigningMethod
+
+	// The transport used to send requests. If not set http.DefaultTransport is used.
+	Base http.RoundTripper
+
+	mu     sync.Mutex
+	nonces map[string]string
+}
+
+// Implement the http.RoundTripper interface.
+//
+// The request is cloned before the `DPoP` header is set as a RoundTripper should not modify the request.
+// A request with a body can only be retried if its GetBody function is set.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	origin := requestOrigin(req.URL)
+	res, err := t.send(req, req.Body, t.nonce(origin))
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := res.Header.Get("DPoP-Nonce")
+	if nonce == "" {
+		return res, nil
+	}
+	t.setNonce(origin, nonce)
+
+	if !isNonceError(res) {
+		return res, nil
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return res, nil
+	}
+
+	// Retry the request once with the new nonce.
+	var body io.ReadCloser
+	if req.GetBody != nil {
+		body, err = req.GetBody()
+		if err != nil {
+			return res, nil
+		}
+	}
+	res.Body.Close()
+
+	res, err = t.send(req, body, nonce)
+	if err != nil {
+		return nil, err
+	}
+	if nonce := res.Header.Get("DPoP-Nonce"); nonce != "" {
+		t.setNonce(origin, nonce)
+	}
+	return res, nil
+}
+
+// Sends a clone of the request with the supplied body and a proof containing the supplied nonce.
+func (t *Transport) send(req *http.Request, body io.ReadCloser, nonce string) (*http.Response, error) {
+	proof, err := t.createProof(req, nonce)
+	if err != nil {
+		if body != nil {
+			body.Close()
+		}
+		return nil, err
+	}
+
+	clone := req.Clone(req.Context())
+	clone.Body = body
+	clone.Header.Set("DPoP", proof)
+	return t.base().RoundTrip(clone)
+}
+
+// Returns the last nonce received from an origin.
+func (t *Transport) nonce(origin string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.nonces[origin]
+}
+
+func (t *Transport) setNonce(origin string, nonce string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.nonces == nil {
+		t.nonces = map[string]string{}
+	}
+	t.nonces[origin] = nonce
+}
+
+// Returns the origin of a URL that nonces are cached for.
+func requestOrigin(u *url.URL) string {
+	scheme, host := normalizeOrigin(u)
+	return scheme + "://" + host
+}
+
+// Checks if a response rejects a request because of a missing or incorrect nonce.
+//
+// Protected resources respond with a challenge, see https://datatracker.ietf.org/doc/html/rfc9449#section-9
+// while authorization servers respond with an error body, see https://datatracker.ietf.org/doc/html/rfc9449#section-8
+func isNonceError(res *http.Response) bool {
+	switch res.StatusCode {
+	case http.StatusUnauthorized:
+		for _, challenge := range res.Header.Values("WWW-Authenticate") {
+			if strings.Contains(challenge, `error="`+ErrorCodeUseDPoPNonce+`"`) {
+				return true
+			}
+		}
+	case http.StatusBadRequest:
+		// Read the start of the body while keeping it readable for the caller.
+		b, err := io.ReadAll(io.LimitReader(res.Body, maxErrorBodySize))
+		res.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(b), res.Body), res.Body}
+		if err != nil {
+			return false
+		}
+
+		errorBody := struct {
+			Error string `json:"error"`
+		}{}
+		if err := json.Unmarshal(b, &errorBody); err != nil {
+			return false
+		}
+		return errorBody.Error == ErrorCodeUseDPoPNonce
+	}
+	return false
+}
+
+// Creates a proof for the request with the supplied nonce.
+func (t *Transport) createProof(req *http.Request, nonce string) (string, error) {
+	httpMethod := HTTPVerb(req.Method)
+	if httpMethod == "" {
+		httpMethod = GET
+	}
+
+	opts := ProofOptions{
+		Nonce:         nonce,
+		SigningMethod: t.SigningMethod,
+	}
+	if accessToken, err := accessTokenFromRequest(req); err == nil {
+		opts.AccessToken = accessToken
+	}
+
+	proof, err := NewProof(httpMethod, req.URL.String(), opts)
+	if err != nil {
+		return "", err
+	}
+	return proof.Sign(t.Key)
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
@@ -0,0 +1,186 @@
+package dpop_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AxisCommunications/go-dpop"
+)
+
+// Test that requests sent through the transport are accepted by the middleware
+func TestTransport(t *testing.T) {
+	// Arrange
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	jkt := testThumbprint(t, privateKey)
+	server := httptest.NewServer(dpop.Middleware(http.NotFoundHandler(), dpop.MiddlewareOptions{
+		ParseOptions: dpop.ParseOptions{ReplayCache: dpop.NewMemoryReplayCache(0)},
+		ParseAccessToken: func(r *http.Request, accessToken string) (dpop.BoundClaims, error) {
+			return &dpop.BoundAccessTokenClaims{
+				Confirmation: dpop.Confirmation{JWKThumbprint: jkt},
+			}, nil
+		},
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: &dpop.Transport{Key: privateKey}}
+
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest("GET", server.URL+"/resource?query=true", nil)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		req.Header.Set("Authorization", "DPoP token")
+
+		// Act
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		res.Body.Close()
+
+		// Assert
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected request to reach handler, got %d: %s", res.StatusCode, res.Header.Get("WWW-Authenticate"))
+		}
+		if req.Header.Get("DPoP") != "" {
+			t.Errorf("Expected original request to be unmodified")
+		}
+	}
+}
+
+// Test that the transport retries with a nonce from the server and reuses it for later requests
+func TestTransport_Nonce(t *testing.T) {
+	// Arrange
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	nonceIssuer, err := dpop.NewNonceIssuer([][]byte{nonceKeyA}, dpop.NonceOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, err := io.ReadAll(r.Body)
+		if err != nil || string(body) != "grant_type=client_credentials" {
+			t.Errorf("Expected request body to be sent, got %q", body)
+		}
+
+		_, err = dpop.ParseRequest(r, dpop.ParseOptions{NonceVerifier: nonceIssuer})
+		if err != nil {
+			nonce, _ := nonceIssuer.Issue()
+			dpop.WriteError(w, err, dpop.ErrorResponseOptions{Nonce: nonce, TokenEndpoint: true})
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: &dpop.Transport{Key: privateKey}}
+
+	// Act
+	first, err := client.Post(server.URL+"/token", "application/x-www-form-urlencoded", strings.NewReader("grant_type=client_credentials"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	first.Body.Close()
+	second, err := client.Post(server.URL+"/token", "application/x-www-form-urlencoded", strings.NewReader("grant_type=client_credentials"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	second.Body.Close()
+
+	// Assert
+	if first.StatusCode != http.StatusOK || second.StatusCode != http.StatusOK {
+		t.Errorf("Expected requests to succeed, got %d and %d", first.StatusCode, second.StatusCode)
+	}
+	if requests != 3 {
+		t.Errorf("Expected one retry, got %d requests", requests)
+	}
+}
+
+// Test that a request with a body that can not be replayed is not retried
+func TestTransport_NonceWithoutGetBody(t *testing.T) {
+	// Arrange
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dpop.WriteError(w, dpop.ErrIncorrectNonce, dpop.ErrorResponseOptions{Nonce: "nonce", TokenEndpoint: true})
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: &dpop.Transport{Key: privateKey}}
+	req, err := http.NewRequest("POST", server.URL+"/token", io.NopCloser(strings.NewReader("body")))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Act
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, res.StatusCode)
+	}
+	if !strings.Contains(string(body), dpop.ErrorCodeUseDPoPNonce) {
+		t.Errorf("Expected error body to be readable, got %q", body)
+	}
+}
+
+// Test that the transport retries when a protected resource challenges it for a nonce
+func TestTransport_ResourceNonce(t *testing.T) {
+	// Arrange
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	jkt := testThumbprint(t, privateKey)
+	nonceIssuer, err := dpop.NewNonceIssuer([][]byte{nonceKeyA}, dpop.NonceOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	server := httptest.NewServer(dpop.Middleware(http.NotFoundHandler(), dpop.MiddlewareOptions{
+		NonceIssuer: nonceIssuer,
+		ParseAccessToken: func(r *http.Request, accessToken string) (dpop.BoundClaims, error) {
+			return &dpop.BoundAccessTokenClaims{
+				Confirmation: dpop.Confirmation{JWKThumbprint: jkt},
+			}, nil
+		},
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: &dpop.Transport{Key: privateKey}}
+	req, err := http.NewRequest("GET", server.URL+"/resource", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	req.Header.Set("Authorization", "DPoP token")
+
+	// Act
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res.Body.Close()
+
+	// Assert
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected request to reach handler, got %d: %s", res.StatusCode, res.Header.Get("WWW-Authenticate"))
+	}
+}